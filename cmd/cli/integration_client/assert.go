@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/assert"
+	"github.com/spf13/cobra"
+)
+
+func newAssertCmd(g *globalOpts) *cobra.Command {
+	var assertOpts assert.Opts
+
+	cmd := &cobra.Command{
+		Use:   "assert <file or dir>...",
+		Short: "Wait for the objects of the yaml files to be in the cluster of an existing environment, only the fields they set are compared",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			ctx := cmd.Context()
+
+			client, err := g.attach(ctx, g.logOutput())
+			if err != nil {
+				return err
+			}
+
+			defer func() {
+				err = errors.Join(err, g.writeReports(client))
+			}()
+
+			return client.Assert(ctx, assertOpts, args...)
+		},
+	}
+
+	f := cmd.Flags()
+	f.DurationVar(&assertOpts.Timeout, "timeout", 2*time.Minute, "how long to wait for the assertions to pass")
+	f.DurationVar(&assertOpts.Interval, "interval", 2*time.Second, "interval between the checks")
+
+	return cmd
+}
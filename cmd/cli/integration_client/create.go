@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/ezratameno/integration/pkg/integration"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newCreateCmd(g *globalOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an environment and wait for the kustomizations to be ready",
+		Args:  cobra.NoArgs,
+	}
+
+	buildOpts := createFlags(cmd.Flags())
+
+	var dryRun bool
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be created without starting any container")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) (err error) {
+		ctx := cmd.Context()
+
+		createOpts, err := buildOpts(g)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(g.logOutput(), "%+v\n", createOpts.Redacted())
+
+		giteaOpts := gitea.Opts{
+			Addr:     "http://localhost",
+			SSHPort:  createOpts.GiteaSshPort,
+			HttpPort: createOpts.GiteaHttpPort,
+			Runtime:  g.runtime,
+		}
+
+		w := g.logger()
+		defer w.Write([]byte("finish"))
+
+		runner := g.runner(w)
+		client, err := integration.NewClient(giteaOpts, runner, w)
+		if err != nil {
+			return err
+		}
+		g.trace(runner, client, w)
+
+		if dryRun {
+			return planCmd(ctx, g, client, createOpts)
+		}
+
+		// The local git server serves the repos only while this process runs, so once the
+		// environment is ready we keep serving until we are interrupted.
+		// it's deferred first so the reports are written before we block.
+		var serve bool
+		defer func() {
+			if !serve {
+				return
+			}
+
+			fmt.Fprintf(os.Stderr, "serving the git repos on port %d, the cluster syncs from them until interrupted\n",
+				createOpts.GiteaHttpPort)
+			<-ctx.Done()
+		}()
+
+		// The report and the summary of the phases are written also when the run failed
+		defer func() {
+			err = errors.Join(err, client.Report().WriteSummary(g.logOutput()), g.writeReports(client))
+		}()
+
+		// On failure the created resources are already removed by Run, unless we keep them
+		_, err = client.Run(ctx, createOpts)
+		if err != nil {
+			if createOpts.KeepOnFailure {
+				fmt.Fprintf(os.Stderr, "resources were kept, remove them with: delete --cluster %s --container %s\n",
+					createOpts.KindClusterName, createOpts.GiteaContainerName)
+			}
+
+			if g.output != "" {
+				res := integration.FailedResult(createOpts.KindClusterName, err)
+				res.Phases = client.Phases()
+				err = errors.Join(err, printOutput(g.output, res))
+			}
+			return err
+		}
+
+		serve = createOpts.GitServer == integration.GitServerLocal
+
+		if g.output == "" {
+			return nil
+		}
+
+		res, err := client.Result(ctx)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(g.output, res)
+	}
+
+	return cmd
+}
+
+// planCmd prints the plan of the environment, also when the preflight checks failed
+func planCmd(ctx context.Context, g *globalOpts, client *integration.Client, createOpts integration.CreateOpts) error {
+	plan, err := client.Plan(ctx, createOpts)
+	if plan == nil {
+		return err
+	}
+
+	if g.output != "" {
+		err = errors.Join(err, printOutput(g.output, plan))
+	} else {
+		printPlan(plan)
+	}
+
+	return err
+}
+
+func newDeleteCmd(g *globalOpts) *cobra.Command {
+	var deleteOpts integration.DeleteOpts
+
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete the cluster and the git server of an environment",
+		Args:  cobra.NoArgs,
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&deleteOpts.ClusterProvider, "provider", "", "the provider that created the cluster, defaults to the one of the saved environment or kind")
+	f.StringVar(&deleteOpts.GitServer, "git-server", "", "the git server of the repos, defaults to the one of the saved environment or gitea")
+	f.StringVar(&deleteOpts.KindClusterName, "cluster", "", "the name of the cluster, defaults to --env")
+	f.StringVar(&deleteOpts.GiteaContainerName, "container", "gitea", "the name of the gitea container")
+	f.BoolVar(&deleteOpts.KeepVolume, "keep-volume", false, "keep the data volume of the gitea container")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if deleteOpts.KindClusterName == "" {
+			deleteOpts.KindClusterName = g.env
+		}
+
+		out := g.logOutput()
+		runner := g.runner(out)
+		client, err := integration.NewClient(gitea.Opts{Runtime: g.runtime}, runner, out)
+		if err != nil {
+			return err
+		}
+		g.trace(runner, client, out)
+
+		err = client.Delete(cmd.Context(), deleteOpts)
+		if err != nil {
+			return err
+		}
+
+		if g.output == "" {
+			return nil
+		}
+
+		return printOutput(g.output, &integration.Result{
+			Env:                deleteOpts.KindClusterName,
+			Status:             integration.StatusDeleted,
+			KindClusterName:    deleteOpts.KindClusterName,
+			GiteaContainerName: deleteOpts.GiteaContainerName,
+		})
+	}
+
+	return cmd
+}
+
+// newDoctorCmd runs the preflight checks without creating anything
+func newDoctorCmd(g *globalOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that an environment can be created on this host, it accepts the flags of create",
+		Args:  cobra.NoArgs,
+	}
+
+	buildOpts := createFlags(cmd.Flags())
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		createOpts, err := buildOpts(g)
+		if err != nil {
+			return err
+		}
+
+		giteaOpts := gitea.Opts{
+			Addr:     "http://localhost",
+			SSHPort:  createOpts.GiteaSshPort,
+			HttpPort: createOpts.GiteaHttpPort,
+			Runtime:  g.runtime,
+		}
+
+		out := g.logOutput()
+		runner := g.runner(out)
+		client, err := integration.NewClient(giteaOpts, runner, out)
+		if err != nil {
+			return err
+		}
+		g.trace(runner, client, out)
+
+		return client.Preflight(cmd.Context(), createOpts)
+	}
+
+	return cmd
+}
+
+// createFlags registers the flags used to describe the environment to create,
+// the returned func builds the options once the flags are parsed.
+func createFlags(f *pflag.FlagSet) func(g *globalOpts) (integration.CreateOpts, error) {
+	var createOpts integration.CreateOpts
+
+	f.IntVar(&createOpts.GiteaHttpPort, "http-port", 3000, "gitea http port")
+	f.IntVar(&createOpts.GiteaSshPort, "ssh-port", 2222, "gitea ssh port")
+	localRepoPaths := f.String("local-repos", "", "comma separated list of paths to local git repos which are in use by flux")
+	f.StringVar(&createOpts.FluxBootstrapRepo, "flux-bootstrap", "", "path to local git repo to bootstrap flux with")
+	f.StringVar(&createOpts.FluxPath, "flux-path", "", "path to bootstrap flux with within the local git repo")
+	f.StringVar(&createOpts.ClusterProvider, "provider", "kind", "the provider that creates the cluster, kind or k3d, or existing to use the cluster of --context")
+	f.StringVar(&createOpts.KubeContext, "context", "", "the kube context of the existing cluster, defaults to the current context")
+	f.StringVar(&createOpts.KindConfigPath, "kind-config", "", "path to the cluster config, a kind config or a k3d config with --provider k3d")
+	f.StringVar(&createOpts.KindClusterName, "cluster", "", "the name of the cluster to be created, defaults to --env")
+	f.StringVar(&createOpts.GiteaContainerName, "container", "gitea", "the name of the gitea container")
+	f.StringVar(&createOpts.PrivateKeyPath, "private-key", "", "where to save the private key of the deploy key of the bootstrap repo, the keys of the other repos are saved next to it")
+	keyAlgorithm := f.String("key-algorithm", string(gitea.KeyEd25519), "the algorithm of the deploy keys, ed25519, ecdsa or rsa")
+	f.BoolVar(&createOpts.PrivateRepos, "private-repos", false, "create the gitea repos private, flux clones them with an access token")
+	f.BoolVar(&createOpts.SkipWebhooks, "skip-webhooks", false, "don't add the webhooks which reconcile flux when the gitea repos are pushed")
+	f.StringVar(&createOpts.GitServer, "git-server", "gitea", "the git server of the repos, gitea or local to serve them with git http-backend run by this process over --http-port, it needs the git binary")
+
+	f.StringVar(&createOpts.GiteaContainer.Image, "gitea-image", gitea.Image, "the image of the gitea container")
+	f.StringVar(&createOpts.GiteaContainer.Tag, "gitea-tag", "", "replaces the tag of --gitea-image, like 1.22.1")
+	f.StringToStringVar(&createOpts.GiteaContainer.Env, "gitea-env", nil, "env of the gitea container, GITEA__section__KEY=value overrides KEY of the section in app.ini")
+	f.StringVar(&createOpts.GiteaContainer.DataVolume, "gitea-volume", "", "a named volume to keep the gitea data in, it's removed with the environment unless delete is run with --keep-volume")
+	f.StringVar(&createOpts.GiteaContainer.Network, "gitea-network", "", "the network to attach the gitea container to")
+	f.StringToStringVar(&createOpts.GiteaContainer.Labels, "gitea-labels", nil, "labels of the gitea container in the format key=value")
+	giteaMemory := f.String("gitea-memory", "", "memory limit of the gitea container, like 512Mi or 1G")
+	f.Float64Var(&createOpts.GiteaContainer.CPUs, "gitea-cpus", 0, "cpus limit of the gitea container, like 1.5")
+
+	images := f.String("kind-images", "", "comma separated list of images or image archives (.tar) to load to the cluster")
+	f.BoolVar(&createOpts.KindPullImages, "pull-images", false, "pull images which are not present locally before loading them")
+	manifests := f.String("manifests", "", "comma separated list of kubernetes manifests to apply")
+	kustomizations := f.String("kustomizations", "", "comma separated list of kustomizations in the format namespace/name")
+	f.BoolVar(&createOpts.WaitForAll, "wait-all", false, "wait for every kustomization and helmrelease created under the flux bootstrap path")
+	f.BoolVar(&createOpts.SkipPreflight, "skip-preflight", false, "skip the checks that run before creating the environment")
+	f.BoolVar(&createOpts.KeepOnFailure, "keep-on-failure", false, "keep the created resources when the creation fails, for debugging")
+	f.BoolVar(&createOpts.Reuse, "reuse", false, "reuse the kind cluster and gitea container if they already exist")
+	f.StringVar(&createOpts.SnapshotName, "snapshot", "", "take a snapshot with this name once the environment is ready")
+
+	return func(g *globalOpts) (integration.CreateOpts, error) {
+		opts := createOpts
+		if opts.KindClusterName == "" {
+			opts.KindClusterName = g.env
+		}
+
+		opts.KeyAlgorithm = gitea.KeyAlgorithm(*keyAlgorithm)
+
+		if *giteaMemory != "" {
+			memory, err := resource.ParseQuantity(*giteaMemory)
+			if err != nil {
+				return opts, fmt.Errorf("invalid gitea memory %q: %w", *giteaMemory, err)
+			}
+			opts.GiteaContainer.Memory = memory.Value()
+		}
+
+		return buildCreateOpts(opts, *images, *manifests, *localRepoPaths, *kustomizations)
+	}
+}
+
+// buildCreateOpts splits the comma separated flags into the options
+func buildCreateOpts(createOpts integration.CreateOpts, images, manifests, localRepoPaths, kustomizations string) (integration.CreateOpts, error) {
+
+	// For empty string
+	if !(len(strings.Split(images, ",")) == 1 && strings.Split(images, ",")[0] == "") {
+		createOpts.KindImageToLoad = strings.Split(images, ",")
+	}
+
+	if !(len(strings.Split(manifests, ",")) == 1 && strings.Split(manifests, ",")[0] == "") {
+		createOpts.ManifestsToApply = strings.Split(manifests, ",")
+	}
+
+	if !(len(strings.Split(localRepoPaths, ",")) == 1 && strings.Split(localRepoPaths, ",")[0] == "") {
+		createOpts.GiteaLocalRepoPaths = strings.Split(localRepoPaths, ",")
+	}
+
+	kss, err := parseKustomizations(kustomizations)
+	if err != nil {
+		return createOpts, err
+	}
+	createOpts.KustomizationsToWaitFor = kss
+
+	return createOpts, nil
+}
+
+// parseKustomizations parses a comma separated list of kustomizations in the format namespace/name
+func parseKustomizations(kustomizations string) ([]types.NamespacedName, error) {
+	var kss []types.NamespacedName
+
+	for _, ks := range strings.Split(kustomizations, ",") {
+
+		if ks == "" {
+			continue
+		}
+		data := strings.Split(ks, "/")
+		if len(data) != 2 {
+			return nil, fmt.Errorf("invalid kustomization format: %s", ks)
+		}
+
+		kss = append(kss, types.NamespacedName{
+			Namespace: data[0],
+			Name:      data[1],
+		})
+	}
+
+	return kss, nil
+}
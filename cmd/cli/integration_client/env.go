@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/ezratameno/integration/pkg/integration"
+	"github.com/spf13/cobra"
+)
+
+// attach returns a client of the existing environment named by --env
+func (g *globalOpts) attach(ctx context.Context, out io.Writer) (*integration.Client, error) {
+	runner := g.runner(out)
+	client, err := integration.Attach(ctx, g.env, runner, out)
+	if err != nil {
+		return nil, err
+	}
+	g.trace(runner, client, out)
+
+	return client, nil
+}
+
+func newStatusCmd(g *globalOpts) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Describe an existing environment",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			client, err := g.attach(ctx, g.logOutput())
+			if err != nil {
+				return err
+			}
+
+			res, err := client.Result(ctx)
+			if err != nil {
+				return err
+			}
+
+			if g.output != "" {
+				return printOutput(g.output, res)
+			}
+
+			printStatus(res)
+
+			return nil
+		},
+	}
+}
+
+func newListCmd(g *globalOpts) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the saved environments",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := g.logOutput()
+			runner := g.runner(out)
+			client, err := integration.NewClient(gitea.Opts{Runtime: g.runtime}, runner, out)
+			if err != nil {
+				return err
+			}
+			g.trace(runner, client, out)
+
+			envs, err := client.List(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if g.output != "" {
+				return printOutput(g.output, envs)
+			}
+
+			printList(envs)
+
+			return nil
+		},
+	}
+}
+
+// newGCCmd removes the stale environments, also the resources of runs which crashed
+func newGCCmd(g *globalOpts) *cobra.Command {
+	var gcOpts integration.GCOpts
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove the environments, containers, key files and kube contexts left behind by old runs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := g.logOutput()
+			runner := g.runner(out)
+			client, err := integration.NewClient(gitea.Opts{Runtime: g.runtime}, runner, out)
+			if err != nil {
+				return err
+			}
+			g.trace(runner, client, out)
+
+			removed, err := client.GC(cmd.Context(), gcOpts)
+
+			if g.output != "" {
+				err = errors.Join(err, printOutput(g.output, removed))
+			}
+
+			return err
+		},
+	}
+
+	f := cmd.Flags()
+	f.DurationVar(&gcOpts.OlderThan, "older-than", time.Hour, "remove the environments created more than this long ago")
+	f.BoolVar(&gcOpts.DryRun, "dry-run", false, "print the stale environments without removing them")
+
+	return cmd
+}
+
+func newSnapshotCmd(g *globalOpts) *cobra.Command {
+	var name string
+
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save the state of an existing environment",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			client, err := g.attach(ctx, g.logOutput())
+			if err != nil {
+				return err
+			}
+
+			return client.Snapshot(ctx, name)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "golden", "the name of the snapshot")
+
+	return cmd
+}
+
+func newRestoreCmd(g *globalOpts) *cobra.Command {
+	var name string
+
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Bring an existing environment back to the state of a snapshot",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			client, err := g.attach(ctx, g.logOutput())
+			if err != nil {
+				return err
+			}
+
+			return client.Restore(ctx, name)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "golden", "the name of the snapshot")
+
+	return cmd
+}
@@ -3,20 +3,34 @@ package main
 import (
 	"context"
 	"errors"
-	"flag"
 	"fmt"
+	"io"
 	"os"
-	"strings"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
-	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
 	"github.com/ezratameno/integration/pkg/integration"
+	"github.com/ezratameno/integration/pkg/redact"
+	"github.com/ezratameno/integration/pkg/report"
 	"github.com/sirupsen/logrus"
-	"k8s.io/apimachinery/pkg/types"
+	"github.com/spf13/cobra"
 )
 
 func main() {
-	ctx := context.Background()
-	err := run(ctx)
+
+	// Cancel the context on the first signal so the created resources are cleaned up,
+	// the second signal will kill the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := newRootCmd().ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(1)
@@ -24,124 +38,153 @@ func main() {
 	}
 }
 
-func run(ctx context.Context) error {
-	switch os.Args[1] {
-	case "create":
-		return createCmd(ctx, os.Args[2:])
-	case "delete":
-		return deleteCmd(ctx, os.Args[2:])
-
-		// TODO:
-	// case "version":
-
-	default:
-		return fmt.Errorf("bad command")
-	}
+// globalOpts are the flags all the commands accept
+type globalOpts struct {
+	env        string
+	verbosity  int
+	output     string
+	kubeconfig string
+
+	// runtime of the containers, detected when the flag is empty
+	runtimeName string
+	runtime     container.Runtime
+
+	// files to write the report of the phases to
+	junitReport string
+	jsonReport  string
+	traceReport string
 }
 
-func deleteCmd(ctx context.Context, args []string) error {
+func newRootCmd() *cobra.Command {
+	var g globalOpts
 
-	var deleteOpts integration.DeleteOpts
+	root := &cobra.Command{
+		Use:   "integration_client",
+		Short: "Create local integration environments of a kind cluster and gitea, bootstrapped with flux",
 
-	f := flag.NewFlagSet("c", flag.ContinueOnError)
-	f.StringVar(&deleteOpts.KindClusterName, "cluster", "integration", "the name of the kind cluster to be created")
-	f.StringVar(&deleteOpts.GiteaContainerName, "container", "gitea", "the name of the gitea container")
-	err := f.Parse(args)
-	if err != nil {
-		if errors.Is(err, flag.ErrHelp) {
-			return nil
-		}
-		return err
-	}
+		// The errors are printed by main, the usage is printed only for bad flags and args
+		SilenceErrors: true,
+		SilenceUsage:  true,
 
-	client, err := integration.NewClient(gitea.Opts{}, os.Stdout)
-	if err != nil {
-		return err
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return g.complete()
+		},
 	}
 
-	return client.Delete(ctx, deleteOpts)
+	f := root.PersistentFlags()
+	f.StringVar(&g.env, "env", "integration", "the name of the environment, which is the name of its kind cluster")
+	f.IntVarP(&g.verbosity, "verbosity", "v", 1, "0 prints only the errors and the results, 2 also prints the commands that are run")
+	f.StringVarP(&g.output, "output", "o", "", "output format of the result, json or yaml")
+	f.StringVar(&g.kubeconfig, "kubeconfig", "", "the kubeconfig the kind clusters are written to, defaults to $KUBECONFIG or ~/.kube/config")
+	f.StringVar(&g.runtimeName, "runtime", "", "the container runtime, docker or podman. defaults to docker when it's installed, otherwise podman")
+	f.StringVar(&g.junitReport, "junit-report", "", "write the phases of create, reconcile and assert to this file as JUnit XML")
+	f.StringVar(&g.jsonReport, "json-report", "", "write the phases of create, reconcile and assert to this file as JSON")
+	f.StringVar(&g.traceReport, "trace-report", "", "write the timings of the phases to this file as a chrome trace, open it in chrome://tracing or ui.perfetto.dev")
+
+	root.AddCommand(
+		newCreateCmd(&g),
+		newDeleteCmd(&g),
+		newDoctorCmd(&g),
+		newStatusCmd(&g),
+		newListCmd(&g),
+		newGCCmd(&g),
+		newSnapshotCmd(&g),
+		newRestoreCmd(&g),
+		newReconcileCmd(&g),
+		newAssertCmd(&g),
+		newVersionCmd(&g),
+	)
+
+	return root
 }
 
-func createCmd(ctx context.Context, args []string) error {
-	var createOpts integration.CreateOpts
-
-	f := flag.NewFlagSet("c", flag.ContinueOnError)
-	f.IntVar(&createOpts.GiteaHttpPort, "http-port", 3000, "gitea http port")
-	f.IntVar(&createOpts.GiteaSshPort, "ssh-port", 2222, "gitea ssh port")
-	localRepoPaths := f.String("local-repos", "", "comma separated list of paths to local git repos which are in use by flux")
-	f.StringVar(&createOpts.FluxBootstrapRepo, "flux-bootstrap", "", "path to local git repo to bootstrap flux with")
-	f.StringVar(&createOpts.FluxPath, "flux-path", "", "path to bootstrap flux with within the local git repo")
-	f.StringVar(&createOpts.KindConfigPath, "kind-config", "", "path to kind cluster config")
-	f.StringVar(&createOpts.KindClusterName, "cluster", "integration", "the name of the kind cluster to be created")
-	f.StringVar(&createOpts.GiteaContainerName, "container", "gitea", "the name of the gitea container")
-
-	images := f.String("kind-images", "", "comma separated list of images to load to the kind cluster")
-	manifests := f.String("manifests", "", "comma separated list of kubernetes manifests to apply")
-	kustomizations := f.String("kustomizations", "", "comma separated list of kustomizations in the format namespace/name")
+// complete validates the global flags and applies them to the process
+func (g *globalOpts) complete() error {
+	switch g.output {
+	case "", "json", "yaml":
+	default:
+		return fmt.Errorf("unsupported output format %q, use json or yaml", g.output)
+	}
 
-	err := f.Parse(args)
+	runtime, err := container.Parse(g.runtimeName)
 	if err != nil {
-		if errors.Is(err, flag.ErrHelp) {
-			return nil
-		}
 		return err
 	}
+	g.runtime = runtime
 
-	// For empty string
-	if !(len(strings.Split(*images, ",")) == 1 && strings.Split(*images, ",")[0] == "") {
-		createOpts.KindImageToLoad = strings.Split(*images, ",")
+	if g.kubeconfig == "" {
+		return nil
 	}
 
-	if !(len(strings.Split(*manifests, ",")) == 1 && strings.Split(*manifests, ",")[0] == "") {
-		createOpts.ManifestsToApply = strings.Split(*manifests, ",")
+	kubeconfig, err := filepath.Abs(g.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of kubeconfig: %w", err)
 	}
 
-	if !(len(strings.Split(*localRepoPaths, ",")) == 1 && strings.Split(*localRepoPaths, ",")[0] == "") {
-		createOpts.GiteaLocalRepoPaths = strings.Split(*localRepoPaths, ",")
-	}
+	// kind, kubectl, flux and the kubernetes clients all read it from the environment
+	return os.Setenv("KUBECONFIG", kubeconfig)
+}
 
-	for _, ks := range strings.Split(*kustomizations, ",") {
+// logOutput returns where to write the progress, stdout is kept clean for machine readable output
+func (g *globalOpts) logOutput() io.Writer {
+	switch {
+	case g.verbosity <= 0:
+		return io.Discard
+	case g.output != "":
+		return os.Stderr
+	}
 
-		if ks == "" {
-			continue
-		}
-		data := strings.Split(ks, "/")
-		if len(data) != 2 {
-			return fmt.Errorf("invalid kustomization format: %s", ks)
-		}
+	return os.Stdout
+}
 
-		createOpts.KustomizationsToWaitFor = append(createOpts.KustomizationsToWaitFor, types.NamespacedName{
-			Namespace: data[0],
-			Name:      data[1],
-		})
+// logger returns a writer that logs the progress
+func (g *globalOpts) logger() io.Writer {
+	log := logrus.New()
+	if g.verbosity <= 0 {
+		log.SetOutput(io.Discard)
 	}
 
-	fmt.Printf("%+v\n", createOpts)
+	return writer{
+		log: log.WithField("service", "cli"),
+	}
+}
 
-	giteaOpts := gitea.Opts{
-		Addr:     "http://localhost",
-		SSHPort:  createOpts.GiteaSshPort,
-		HttpPort: createOpts.GiteaHttpPort,
+// runner returns the runner of the commands, with verbosity 2 it prints the command lines.
+// until the redactor of the client is known only the secrets matching the patterns are masked.
+func (g *globalOpts) runner(out io.Writer) *exec.TraceRunner {
+	runner := exec.NewTraceRunner(exec.NewLocalRunner())
+	if g.verbosity >= 2 {
+		runner.Out = redact.New().Writer(out)
 	}
 
-	log := logrus.New().WithField("service", "cli")
+	return runner
+}
 
-	w := writer{
-		log: log,
+// trace prints the command lines through the redactor of the client
+func (g *globalOpts) trace(runner *exec.TraceRunner, client *integration.Client, out io.Writer) {
+	if runner.Out != nil {
+		runner.Out = client.Redactor().Writer(out)
 	}
+}
 
-	defer w.Write([]byte("finish"))
+// writeReports writes the report of the client to the files of the report flags
+func (g *globalOpts) writeReports(client *integration.Client) error {
+	var genErr error
 
-	client, err := integration.NewClient(giteaOpts, w)
-	if err != nil {
-		return err
+	if g.junitReport != "" {
+		genErr = errors.Join(genErr, client.Report().WriteFile(g.junitReport, (*report.Report).WriteJUnit))
 	}
 
-	_, err = client.Run(ctx, createOpts)
-	if err != nil {
-		return err
+	if g.jsonReport != "" {
+		genErr = errors.Join(genErr, client.Report().WriteFile(g.jsonReport, (*report.Report).WriteJSON))
 	}
-	return nil
+
+	if g.traceReport != "" {
+		genErr = errors.Join(genErr, client.Report().WriteFile(g.traceReport, (*report.Report).WriteTrace))
+	}
+
+	return genErr
 }
 
 type writer struct {
@@ -150,5 +193,5 @@ type writer struct {
 
 func (w writer) Write(p []byte) (n int, err error) {
 	w.log.Info(string(p))
-	return 0, nil
+	return len(p), nil
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ezratameno/integration/pkg/integration"
+	"sigs.k8s.io/yaml"
+)
+
+// printOutput prints v to stdout in the format
+func printOutput(format string, v any) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+
+	case "yaml":
+		body, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(body)
+		return err
+
+	default:
+		return fmt.Errorf("unsupported output format %q, use json or yaml", format)
+	}
+}
+
+func printStatus(res *integration.Result) {
+	fmt.Printf("env:        %s\n", res.Env)
+	fmt.Printf("status:     %s\n", res.Status)
+	fmt.Printf("kubeconfig: %s (context %s)\n", res.Kubeconfig, res.KubeContext)
+
+	if res.Git != nil {
+		fmt.Printf("%-11s %s (user %s, credentials in %s)\n", res.GitServer+":", res.Git.URL, res.Git.Username, res.Git.CredentialsFile)
+	}
+
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tURL\tLOCAL PATH")
+	for _, repo := range res.Repos {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", repo.Name, repo.URL, repo.LocalPath)
+	}
+	w.Flush()
+
+	fmt.Println()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tKUSTOMIZATION\tREADY\tREVISION\tMESSAGE")
+	for _, ks := range res.Kustomizations {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", ks.Namespace, ks.Name, ks.Ready, ks.Revision, ks.Message)
+	}
+	w.Flush()
+}
+
+func printList(envs []integration.EnvSummary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tCLUSTER\tGIT SERVER\tCONTAINER\tGIT URL\tCREATED")
+	for _, env := range envs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", env.Name, env.Status, env.KindClusterName, env.GitServer,
+			env.GiteaContainerName, env.GitURL, env.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+}
+
+func printPlan(plan *integration.Plan) {
+	fmt.Printf("env:             %s\n", plan.Env)
+	fmt.Printf("cluster:         %s (%s)\n", plan.KindClusterName, plan.ClusterProvider)
+	if plan.GiteaContainerName != "" {
+		fmt.Printf("gitea container: %s (%s, %s, user %s)\n", plan.GiteaContainerName, plan.GiteaImage, plan.GitURL, plan.GiteaUsername)
+	} else {
+		fmt.Printf("git server:      %s (%s, user %s)\n", plan.GitServer, plan.GitURL, plan.GiteaUsername)
+	}
+	fmt.Println()
+
+	if plan.KindConfig != "" {
+		fmt.Printf("%s config:\n", plan.ClusterProvider)
+		fmt.Println(plan.KindConfig)
+	}
+
+	for _, repo := range plan.Repos {
+		fmt.Printf("repo %s from %s, %d files:\n", repo.Name, repo.LocalPath, len(repo.Files))
+		for _, file := range repo.Files {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+	fmt.Println()
+
+	fmt.Println("flux bootstrap:")
+	fmt.Printf("  url:          %s\n", plan.Bootstrap.URL)
+	fmt.Printf("  branch:       %s\n", plan.Bootstrap.Branch)
+	fmt.Printf("  path:         %s\n", plan.Bootstrap.Path)
+	fmt.Printf("  username:     %s\n", plan.Bootstrap.Username)
+	fmt.Printf("  gitrepo url:  %s\n", plan.Bootstrap.GitRepoURL)
+
+	if plan.Bootstrap.Receiver != "" {
+		fmt.Printf("  receiver:     %s\n", plan.Bootstrap.Receiver)
+	}
+	fmt.Println()
+
+	if len(plan.Images) > 0 {
+		fmt.Println("images to load:")
+		for _, image := range plan.Images {
+			if image.Archive {
+				fmt.Printf("  %s (archive)\n", image.Image)
+				continue
+			}
+			fmt.Printf("  %s\n", image.Image)
+		}
+		fmt.Println()
+	}
+
+	if len(plan.Manifests) > 0 {
+		fmt.Println("manifests to apply:")
+		for _, manifest := range plan.Manifests {
+			fmt.Printf("  %s\n", manifest)
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("kustomizations by order of deps:")
+	for i, level := range plan.KustomizationLevels {
+		fmt.Printf("  %d: %s\n", i, strings.Join(level, ", "))
+	}
+
+	if len(plan.HelmReleases) > 0 {
+		fmt.Printf("helmreleases:    %s\n", strings.Join(plan.HelmReleases, ", "))
+	}
+
+	if len(plan.GitRepositories) > 0 {
+		fmt.Println("gitrepositories:")
+		for _, gitRepo := range plan.GitRepositories {
+			fmt.Printf("  %s\n", gitRepo)
+		}
+	}
+
+	for _, url := range plan.MissingRepos {
+		fmt.Printf("missing repo:    %s is not in the local repos\n", url)
+	}
+
+	for _, problem := range plan.Problems {
+		fmt.Printf("problem:         %s\n", problem)
+	}
+
+	if len(plan.WaitFor) > 0 {
+		fmt.Printf("wait for:        %s\n", strings.Join(plan.WaitFor, ", "))
+	}
+
+	if plan.WaitForAll {
+		fmt.Println("wait for:        all the kustomizations and helmreleases")
+	}
+
+	if plan.SnapshotName != "" {
+		fmt.Printf("snapshot:        %s\n", plan.SnapshotName)
+	}
+}
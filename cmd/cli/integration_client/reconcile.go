@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/integration"
+	"github.com/spf13/cobra"
+)
+
+func newReconcileCmd(g *globalOpts) *cobra.Command {
+	var reconcileOpts integration.ReconcileOpts
+	var kustomizations string
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Reconcile the kustomizations of an existing environment by the order of their dependencies",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			ctx := cmd.Context()
+
+			kss, err := parseKustomizations(kustomizations)
+			if err != nil {
+				return err
+			}
+			reconcileOpts.Kustomizations = kss
+
+			client, err := g.attach(ctx, g.logOutput())
+			if err != nil {
+				return err
+			}
+
+			defer func() {
+				err = errors.Join(err, g.writeReports(client))
+			}()
+
+			// The results are printed also when the reconciliation failed
+			results, err := client.Reconcile(ctx, reconcileOpts)
+			if results != nil {
+				if g.output != "" {
+					err = errors.Join(err, printOutput(g.output, results))
+				} else {
+					printReconcileResults(results)
+				}
+			}
+
+			return err
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&reconcileOpts.Push, "push", false, "push the local repos to gitea and fetch the sources before reconciling")
+	f.StringVar(&kustomizations, "kustomizations", "", "comma separated list of kustomizations in the format namespace/name, all of them when empty")
+	f.DurationVar(&reconcileOpts.Timeout, "timeout", 5*time.Minute, "timeout of the reconciliation of each kustomization")
+
+	return cmd
+}
+
+func printReconcileResults(results []integration.ReconcileResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tNAMESPACE\tKUSTOMIZATION\tREVISION\tDURATION\tSTATUS\tERROR")
+	for _, res := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", res.Level, res.Namespace, res.Name, res.Revision, res.Duration, res.Status, res.Error)
+	}
+	w.Flush()
+}
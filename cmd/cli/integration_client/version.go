@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/ezratameno/integration/pkg/integration"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/kind/pkg/apis/config/defaults"
+)
+
+// version is set at build time with -ldflags "-X main.version=<version>"
+var version = "dev"
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+
+	GiteaImage     string `json:"giteaImage"`
+	Kind           string `json:"kind"`
+	KindNodeImage  string `json:"kindNodeImage"`
+	FluxMinVersion string `json:"fluxMinVersion"`
+}
+
+func newVersionCmd(g *globalOpts) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version and the versions of gitea, kind and flux in use",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := getVersionInfo()
+
+			if g.output != "" {
+				return printOutput(g.output, info)
+			}
+
+			fmt.Printf("version:          %s\n", info.Version)
+			if info.Commit != "" {
+				fmt.Printf("commit:           %s\n", info.Commit)
+			}
+			fmt.Printf("go:               %s\n", info.GoVersion)
+			fmt.Printf("gitea image:      %s\n", info.GiteaImage)
+			fmt.Printf("kind:             %s\n", info.Kind)
+			fmt.Printf("kind node image:  %s\n", info.KindNodeImage)
+			fmt.Printf("flux cli minimum: %s\n", info.FluxMinVersion)
+
+			return nil
+		},
+	}
+}
+
+func getVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:        version,
+		GoVersion:      runtime.Version(),
+		GiteaImage:     gitea.Image,
+		KindNodeImage:  defaults.Image,
+		FluxMinVersion: integration.MinVersion("flux"),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, setting := range bi.Settings {
+		if setting.Key == "vcs.revision" {
+			info.Commit = setting.Value
+		}
+	}
+
+	for _, dep := range bi.Deps {
+		if dep.Path == "sigs.k8s.io/kind" {
+			info.Kind = dep.Version
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,309 @@
+package assert
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/yaml"
+)
+
+// Assertion is an object expected to be in the cluster, only the fields it sets are compared.
+// without a name any object of the kind in the namespace, with the labels of the assertion, can match it.
+type Assertion struct {
+	Object *unstructured.Unstructured
+
+	// File the assertion was loaded from
+	File string
+}
+
+func (a Assertion) String() string {
+	name := a.Object.GetName()
+	if name == "" {
+		name = "*"
+	}
+
+	if ns := a.Object.GetNamespace(); ns != "" {
+		name = ns + "/" + name
+	}
+
+	return fmt.Sprintf("%s %s", a.Object.GetKind(), name)
+}
+
+type Opts struct {
+	// Timeout to wait for the assertions to pass, defaults to 2 minutes
+	Timeout time.Duration
+
+	// Interval between the checks, defaults to 2 seconds
+	Interval time.Duration
+}
+
+type Client struct {
+	kubeClient client.Client
+	out        io.Writer
+}
+
+// NewClient returns a client of the cluster of the kube context, the current context when it's empty
+func NewClient(kubeContext string, out io.Writer) (*Client, error) {
+	cfg, err := config.GetConfigWithContext(kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
+
+	kubeClient, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		kubeClient: kubeClient,
+		out:        out,
+	}, nil
+}
+
+// Load reads the assertions from yaml files, the yaml files of dirs are read recursively.
+// it fails when no assertion is found, so a wrong path doesn't pass.
+func Load(paths ...string) ([]Assertion, error) {
+	var assertions []Assertion
+
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() || (filepath.Ext(file) != ".yaml" && filepath.Ext(file) != ".yml") {
+				return nil
+			}
+
+			fileAssertions, err := loadFile(file)
+			if err != nil {
+				return err
+			}
+
+			assertions = append(assertions, fileAssertions...)
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load assertions from %s: %w", p, err)
+		}
+	}
+
+	if len(assertions) == 0 {
+		return nil, fmt.Errorf("no assertions found in %s", strings.Join(paths, ", "))
+	}
+
+	return assertions, nil
+}
+
+func loadFile(file string) ([]Assertion, error) {
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var assertions []Assertion
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(body)))
+	for {
+		doc, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return assertions, nil
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		var obj map[string]any
+		err = yaml.Unmarshal(doc, &obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+
+		// Empty documents
+		if len(obj) == 0 {
+			continue
+		}
+
+		u := &unstructured.Unstructured{Object: obj}
+		if u.GetAPIVersion() == "" || u.GetKind() == "" {
+			return nil, fmt.Errorf("%s: apiVersion and kind are required", file)
+		}
+
+		assertions = append(assertions, Assertion{
+			Object: u,
+			File:   file,
+		})
+	}
+}
+
+// Result is the result of an assertion
+type Result struct {
+	Assertion Assertion
+	StartedAt time.Time
+	Duration  time.Duration
+
+	// Err holds the differences when the assertion didn't pass
+	Err error
+}
+
+// Check waits for the assertions to pass and returns the result of each one, by the order of the assertions
+func (c *Client) Check(ctx context.Context, opts Opts, assertions ...Assertion) []Result {
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+
+	if opts.Interval == 0 {
+		opts.Interval = 2 * time.Second
+	}
+
+	type resp struct {
+		i   int
+		res Result
+	}
+
+	respCh := make(chan resp)
+	for i, a := range assertions {
+		go func(i int, a Assertion) {
+			start := time.Now()
+			err := c.assert(ctx, opts, a)
+
+			respCh <- resp{
+				i: i,
+				res: Result{
+					Assertion: a,
+					StartedAt: start,
+					Duration:  time.Since(start),
+					Err:       err,
+				},
+			}
+		}(i, a)
+	}
+
+	results := make([]Result, len(assertions))
+	for i := 0; i < len(assertions); i++ {
+		r := <-respCh
+		results[r.i] = r.res
+	}
+
+	return results
+}
+
+// Assert waits for the assertions to pass, the differences of the assertions
+// which didn't pass before the timeout are returned.
+func (c *Client) Assert(ctx context.Context, opts Opts, assertions ...Assertion) error {
+	var genErr error
+	for _, res := range c.Check(ctx, opts, assertions...) {
+		genErr = errors.Join(genErr, res.Err)
+	}
+
+	if genErr != nil {
+		return fmt.Errorf("assertions failed: %w", genErr)
+	}
+
+	return nil
+}
+
+// AssertFiles loads the assertions of the paths and waits for them to pass
+func (c *Client) AssertFiles(ctx context.Context, opts Opts, paths ...string) error {
+	assertions, err := Load(paths...)
+	if err != nil {
+		return err
+	}
+
+	return c.Assert(ctx, opts, assertions...)
+}
+
+func (c *Client) assert(ctx context.Context, opts Opts, a Assertion) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var diffs []string
+	err := wait.PollUntilContextCancel(ctx, opts.Interval, true, func(ctx context.Context) (bool, error) {
+		var err error
+		diffs, err = c.check(ctx, a)
+		if err != nil {
+			return false, err
+		}
+
+		return len(diffs) == 0, nil
+	})
+
+	if err != nil {
+		if len(diffs) > 0 && errors.Is(err, ctx.Err()) {
+			return fmt.Errorf("%s (%s):\n  %s", a, a.File, strings.Join(diffs, "\n  "))
+		}
+		return fmt.Errorf("%s (%s): %w", a, a.File, err)
+	}
+
+	fmt.Fprintf(c.out, "assertion %s passed \n", a)
+
+	return nil
+}
+
+// check returns the differences between the assertion and the objects in the cluster
+func (c *Client) check(ctx context.Context, a Assertion) ([]string, error) {
+	expected := a.Object
+
+	if expected.GetName() != "" {
+		actual := &unstructured.Unstructured{}
+		actual.SetGroupVersionKind(expected.GroupVersionKind())
+
+		err := c.kubeClient.Get(ctx, types.NamespacedName{Namespace: expected.GetNamespace(), Name: expected.GetName()}, actual)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return []string{"not found"}, nil
+			}
+			return nil, err
+		}
+
+		return match(expected.Object, actual.Object, ""), nil
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(expected.GroupVersionKind())
+
+	err := c.kubeClient.List(ctx, list,
+		client.InNamespace(expected.GetNamespace()),
+		client.MatchingLabelsSelector{Selector: labels.SelectorFromSet(expected.GetLabels())},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list.Items) == 0 {
+		return []string{"no objects found"}, nil
+	}
+
+	// Any object can match, the differences of the closest one are returned
+	var closest []string
+	for _, actual := range list.Items {
+		diffs := match(expected.Object, actual.Object, "")
+		if len(diffs) == 0 {
+			return nil, nil
+		}
+
+		if closest == nil || len(diffs) < len(closest) {
+			closest = append([]string{fmt.Sprintf("closest object %s:", actual.GetName())}, diffs...)
+		}
+	}
+
+	return closest, nil
+}
@@ -0,0 +1,126 @@
+package assert
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMatch(t *testing.T) {
+	actual := map[string]any{
+		"spec": map[string]any{
+			"replicas": int64(3),
+			"ports": []any{
+				map[string]any{"name": "http", "port": int64(80)},
+				map[string]any{"name": "https", "port": int64(443)},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		expected map[string]any
+		diffs    []string
+	}{
+		{
+			name:     "subset",
+			expected: map[string]any{"spec": map[string]any{"replicas": float64(3)}},
+		},
+		{
+			name: "list in any order",
+			expected: map[string]any{"spec": map[string]any{"ports": []any{
+				map[string]any{"port": float64(443)},
+				map[string]any{"name": "http"},
+			}}},
+		},
+		{
+			name:     "different value",
+			expected: map[string]any{"spec": map[string]any{"replicas": float64(1)}},
+			diffs:    []string{"spec.replicas: expected 1, got 3"},
+		},
+		{
+			name:     "missing field",
+			expected: map[string]any{"status": map[string]any{"ready": true}},
+			diffs:    []string{"status: missing, expected an object"},
+		},
+		{
+			name: "no matching element",
+			expected: map[string]any{"spec": map[string]any{"ports": []any{
+				map[string]any{"name": "http", "port": float64(8080)},
+			}}},
+			diffs: []string{
+				"spec.ports[0]: no matching element",
+				"spec.ports[0].port: expected 8080, got 80",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.diffs, match(tt.expected, actual, ""))
+		})
+	}
+}
+
+func TestAssert(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "cm.yaml"), []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: default
+data:
+  mode: debug
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: default
+  labels:
+    app: web
+data:
+  mode: debug
+`), 0644)
+	require.NoError(t, err)
+
+	assertions, err := Load(dir)
+	require.NoError(t, err)
+	require.Len(t, assertions, 2)
+
+	_, err = Load(t.TempDir())
+	require.ErrorContains(t, err, "no assertions found")
+
+	c := &Client{
+		kubeClient: fake.NewClientBuilder().WithObjects(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+				Data:       map[string]string{"mode": "debug", "level": "1"},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}},
+				Data:       map[string]string{"mode": "release"},
+			},
+		).Build(),
+		out: io.Discard,
+	}
+
+	opts := Opts{
+		Timeout:  100 * time.Millisecond,
+		Interval: 10 * time.Millisecond,
+	}
+
+	err = c.Assert(context.Background(), opts, assertions[0])
+	require.NoError(t, err)
+
+	err = c.Assert(context.Background(), opts, assertions[1])
+	require.ErrorContains(t, err, `data.mode: expected "debug", got "release"`)
+}
@@ -0,0 +1,144 @@
+package assert
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// match checks that expected is a subset of actual and returns the differences.
+// maps match when every expected key matches, lists match when every expected
+// element matches a different element of the actual list, in any order.
+func match(expected, actual any, path string) []string {
+
+	switch exp := expected.(type) {
+	case map[string]any:
+		act, ok := actual.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %s", displayPath(path), display(actual))}
+		}
+
+		keys := make([]string, 0, len(exp))
+		for k := range exp {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, k := range keys {
+			v, ok := act[k]
+			if !ok {
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", joinPath(path, k), display(exp[k])))
+				continue
+			}
+
+			diffs = append(diffs, match(exp[k], v, joinPath(path, k))...)
+		}
+
+		return diffs
+
+	case []any:
+		act, ok := actual.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a list, got %s", displayPath(path), display(actual))}
+		}
+
+		used := make([]bool, len(act))
+
+		var diffs []string
+		for i, e := range exp {
+			found := false
+			for j, a := range act {
+				if used[j] || len(match(e, a, "")) > 0 {
+					continue
+				}
+
+				used[j] = true
+				found = true
+				break
+			}
+
+			if found {
+				continue
+			}
+
+			// Show the differences from the element in the same place, it's usually the one that was meant
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			if i < len(act) {
+				diffs = append(diffs, fmt.Sprintf("%s: no matching element", elemPath))
+				diffs = append(diffs, match(e, act[i], elemPath)...)
+				continue
+			}
+
+			diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", elemPath, display(e)))
+		}
+
+		return diffs
+
+	default:
+		if equal(expected, actual) {
+			return nil
+		}
+
+		return []string{fmt.Sprintf("%s: expected %s, got %s", displayPath(path), display(expected), display(actual))}
+	}
+}
+
+// equal compares scalars, the numbers of the yaml files and of the cluster are decoded to different types
+func equal(expected, actual any) bool {
+	e, eok := toFloat(expected)
+	a, aok := toFloat(actual)
+	if eok && aok {
+		return e == a
+	}
+
+	return reflect.DeepEqual(expected, actual)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "."
+	}
+
+	return path
+}
+
+func display(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "a list"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case nil:
+		return "null"
+	}
+
+	return fmt.Sprintf("%v", v)
+}
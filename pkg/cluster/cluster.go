@@ -0,0 +1,64 @@
+package cluster
+
+import "context"
+
+// Provider creates the kubernetes cluster of an environment, like kind or k3d.
+// the clusters are written to the kubeconfig in $KUBECONFIG or ~/.kube/config.
+type Provider interface {
+	// Name of the provider, it's saved with the environment
+	Name() string
+
+	// Create creates the cluster, configPath is the config file of the provider and it's optional.
+	// the labels are set on the nodes of the cluster, where the provider supports it
+	Create(ctx context.Context, name string, configPath string, labels map[string]string) error
+
+	// Delete deletes the cluster and removes it from the kubeconfig
+	Delete(ctx context.Context, name string) error
+
+	// Exists checks if a cluster with the name exists
+	Exists(ctx context.Context, name string) (bool, error)
+
+	// LoadImages loads the images to all the nodes of the cluster
+	LoadImages(ctx context.Context, opts LoadImagesOpts) error
+
+	// Kubeconfig returns a kubeconfig with only the cluster
+	Kubeconfig(ctx context.Context, name string) ([]byte, error)
+
+	// KubeContext returns the context of the cluster in the kubeconfig
+	KubeContext(name string) string
+
+	// Nodes returns the names of the node containers of the cluster
+	Nodes(ctx context.Context, name string) ([]string, error)
+
+	// Network returns the container network of the nodes of the cluster, empty when the nodes aren't containers
+	Network(name string) string
+}
+
+type LoadImagesOpts struct {
+	ClusterName string
+
+	// Images to load, either an image reference in the local docker daemon
+	// or a path to an image archive ending with .tar. they are expected without duplicates
+	Images []string
+
+	// Pull images which are not present in the local docker daemon
+	Pull bool
+
+	// How many images to load at the same time, default to 4
+	Parallelism int
+
+	// Directory to cache the saved image archives, default to the user cache dir
+	CacheDir string
+
+	// Phase runs the load of each image, it can be used to time the loads
+	Phase func(image string, load func() error) error
+}
+
+// RunPhase runs load with the phase of the options, or directly when there isn't one
+func (o LoadImagesOpts) RunPhase(image string, load func() error) error {
+	if o.Phase == nil {
+		return load()
+	}
+
+	return o.Phase(image, load)
+}
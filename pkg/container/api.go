@@ -0,0 +1,177 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+)
+
+// ErrCreate is returned by Run when the container was not created
+var ErrCreate = errors.New("failed to create container")
+
+// apiClient returns a client of the engine api of the runtime. docker is reached on DOCKER_HOST or
+// its default socket, podman serves the same api on CONTAINER_HOST or on the socket of podman.socket.
+func (r Runtime) apiClient() (*client.Client, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if r == Podman {
+		opts = append(opts, client.WithHost(podmanHost()))
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s api client: %w", r.Binary(), err)
+	}
+
+	return cli, nil
+}
+
+// podmanHost returns the address of the api of podman, the socket of the user when it's rootless
+func podmanHost() string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Geteuid() != 0 {
+		return "unix://" + filepath.Join(dir, "podman", "podman.sock")
+	}
+
+	return "unix:///run/podman/podman.sock"
+}
+
+// Ping checks that the engine api of the runtime answers
+func (r Runtime) Ping(ctx context.Context) error {
+	cli, err := r.apiClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	_, err = cli.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("%s api is not reachable on %s: %w", r.Binary(), cli.DaemonHost(), err)
+	}
+
+	return nil
+}
+
+// Run creates and starts the container of the spec with the engine api of the runtime, the image is
+// pulled when it's missing like docker run does. it returns ErrCreate when the container wasn't created.
+func (r Runtime) Run(ctx context.Context, spec Spec) error {
+	cli, err := r.apiClient()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCreate, err)
+	}
+	defer cli.Close()
+
+	err = pullMissing(ctx, cli, spec.Image)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCreate, err)
+	}
+
+	config, hostConfig, err := createConfig(spec)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCreate, err)
+	}
+
+	created, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, spec.Name)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrCreate, spec.Name, err)
+	}
+
+	err = cli.ContainerStart(ctx, created.ID, container.StartOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start container %s: %w", spec.Name, err)
+	}
+
+	return nil
+}
+
+// createConfig returns the configs the container of the spec is created with,
+// the env is sorted so the same spec always makes the same config.
+func createConfig(spec Spec) (*container.Config, *container.HostConfig, error) {
+	config := &container.Config{
+		Image:        spec.Image,
+		Labels:       spec.Labels,
+		ExposedPorts: nat.PortSet{},
+	}
+
+	for _, key := range sortedKeys(spec.Env) {
+		config.Env = append(config.Env, fmt.Sprintf("%s=%s", key, spec.Env[key]))
+	}
+
+	hostConfig := &container.HostConfig{
+		PortBindings: nat.PortMap{},
+		NetworkMode:  container.NetworkMode(spec.Network),
+		Resources: container.Resources{
+			Memory:   spec.Memory,
+			NanoCPUs: int64(spec.CPUs * 1e9),
+		},
+	}
+
+	for _, port := range spec.Ports {
+		containerPort, err := nat.NewPort("tcp", strconv.Itoa(port.Container))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid port %d: %w", port.Container, err)
+		}
+
+		config.ExposedPorts[containerPort] = struct{}{}
+		hostConfig.PortBindings[containerPort] = append(hostConfig.PortBindings[containerPort],
+			nat.PortBinding{HostPort: strconv.Itoa(port.Host)})
+	}
+
+	// A named volume is created by the runtime when it doesn't exist
+	for _, volume := range spec.Volumes {
+		hostConfig.Binds = append(hostConfig.Binds, fmt.Sprintf("%s:%s", volume.Name, volume.Path))
+	}
+
+	return config, hostConfig, nil
+}
+
+// pullMissing pulls the image when it isn't present, the errors of the pull come in its progress stream
+func pullMissing(ctx context.Context, cli *client.Client, ref string) error {
+	_, _, err := cli.ImageInspectWithRaw(ctx, ref)
+	if err == nil {
+		return nil
+	}
+
+	if !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %w", ref, err)
+	}
+
+	progress, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", ref, err)
+	}
+	defer progress.Close()
+
+	dec := json.NewDecoder(progress)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+
+		err := dec.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read the pull progress of image %s: %w", ref, err)
+		}
+
+		if msg.Error != "" {
+			return fmt.Errorf("failed to pull image %s: %s", ref, msg.Error)
+		}
+	}
+}
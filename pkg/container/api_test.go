@@ -0,0 +1,141 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateConfig(t *testing.T) {
+
+	config, hostConfig, err := createConfig(Spec{
+		Name:  "gitea",
+		Image: "gitea/gitea:1.22.1",
+		Ports: []Port{{Host: 3000, Container: 3000}, {Host: 2222, Container: 22}},
+		Env: map[string]string{
+			"GITEA__server__ROOT_URL":       "http://localhost:3000",
+			"GITEA__security__INSTALL_LOCK": "true",
+		},
+		Labels:  map[string]string{"owner": "integration"},
+		Volumes: []Volume{{Name: "gitea-data", Path: "/data"}},
+		Network: "kind",
+		Memory:  512 << 20,
+		CPUs:    1.5,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "gitea/gitea:1.22.1", config.Image)
+	require.Equal(t, []string{"GITEA__security__INSTALL_LOCK=true", "GITEA__server__ROOT_URL=http://localhost:3000"}, config.Env)
+	require.Equal(t, map[string]string{"owner": "integration"}, config.Labels)
+	require.Equal(t, nat.PortSet{"3000/tcp": {}, "22/tcp": {}}, config.ExposedPorts)
+
+	require.Equal(t, nat.PortMap{
+		"3000/tcp": {{HostPort: "3000"}},
+		"22/tcp":   {{HostPort: "2222"}},
+	}, hostConfig.PortBindings)
+	require.Equal(t, []string{"gitea-data:/data"}, hostConfig.Binds)
+	require.Equal(t, container.NetworkMode("kind"), hostConfig.NetworkMode)
+	require.Equal(t, int64(512<<20), hostConfig.Memory)
+	require.Equal(t, int64(1.5e9), hostConfig.NanoCPUs)
+
+	// Without limits only the image is set
+	_, hostConfig, err = createConfig(Spec{Name: "gitea", Image: "gitea/gitea"})
+	require.NoError(t, err)
+	require.Zero(t, hostConfig.Memory)
+	require.Zero(t, hostConfig.NanoCPUs)
+	require.Empty(t, hostConfig.NetworkMode)
+}
+
+// fakeEngine serves the calls of the engine api Run makes, the image is missing so it's pulled
+func fakeEngine(t *testing.T, pullErr string) *[]string {
+	var calls []string
+	version := regexp.MustCompile(`^/v[0-9.]+`)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := version.ReplaceAllString(r.URL.Path, "")
+		calls = append(calls, r.Method+" "+path)
+
+		w.Header().Set("Api-Version", "1.45")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case path == "/_ping":
+			w.Write([]byte("OK"))
+
+		case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json"):
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such image: gitea/gitea:1.22.1"}`))
+
+		case path == "/images/create":
+			require.Equal(t, "gitea/gitea", r.URL.Query().Get("fromImage"))
+			require.Equal(t, "1.22.1", r.URL.Query().Get("tag"))
+			w.Write([]byte(`{"status":"Pulling from gitea/gitea"}` + "\n"))
+			if pullErr != "" {
+				w.Write([]byte(`{"error":"` + pullErr + `"}` + "\n"))
+			}
+
+		case path == "/containers/create":
+			require.Equal(t, "gitea", r.URL.Query().Get("name"))
+
+			var body container.Config
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "gitea/gitea:1.22.1", body.Image)
+
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"1a2b"}`))
+
+		case path == "/containers/1a2b/start":
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Setenv("DOCKER_HOST", "tcp://"+srv.Listener.Addr().String())
+
+	return &calls
+}
+
+func TestRun(t *testing.T) {
+	calls := fakeEngine(t, "")
+
+	err := Docker.Run(context.Background(), Spec{Name: "gitea", Image: "gitea/gitea:1.22.1"})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"GET /images/gitea/gitea:1.22.1/json",
+		"POST /images/create",
+		"POST /containers/create",
+		"POST /containers/1a2b/start",
+	}, filterPing(*calls))
+}
+
+func TestRunPullError(t *testing.T) {
+	calls := fakeEngine(t, "manifest unknown")
+
+	err := Docker.Run(context.Background(), Spec{Name: "gitea", Image: "gitea/gitea:1.22.1"})
+	require.ErrorIs(t, err, ErrCreate)
+	require.ErrorContains(t, err, "manifest unknown")
+	require.NotContains(t, *calls, "POST /containers/create")
+}
+
+func filterPing(calls []string) []string {
+	var filtered []string
+	for _, call := range calls {
+		if !strings.HasSuffix(call, "/_ping") {
+			filtered = append(filtered, call)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,159 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	osexec "os/exec"
+	"sort"
+	"strings"
+
+	"github.com/ezratameno/integration/pkg/exec"
+)
+
+// Runtime is the container runtime the gitea container and the cluster nodes are run with,
+// podman has a docker compatible cli and engine api, so the same commands and api calls are used with it.
+type Runtime string
+
+const (
+	Docker Runtime = "docker"
+	Podman Runtime = "podman"
+)
+
+// Parse returns the runtime of the name, the runtime is detected when the name is empty
+func Parse(name string) (Runtime, error) {
+	switch Runtime(name) {
+	case "":
+		return Detect(), nil
+	case Docker, Podman:
+		return Runtime(name), nil
+	}
+
+	return "", fmt.Errorf("unknown container runtime %q, use docker or podman", name)
+}
+
+// Detect returns docker when its binary is found, otherwise podman when its binary is found.
+// docker is returned when none is found so the preflight checks report it.
+func Detect() Runtime {
+	for _, rt := range []Runtime{Docker, Podman} {
+		_, err := osexec.LookPath(string(rt))
+		if err == nil {
+			return rt
+		}
+	}
+
+	return Docker
+}
+
+// Binary returns the binary of the runtime, docker for the zero value
+func (r Runtime) Binary() string {
+	if r == "" {
+		return string(Docker)
+	}
+
+	return string(r)
+}
+
+// Command returns a command of the runtime binary
+func (r Runtime) Command(args ...string) exec.Cmd {
+	return exec.Command(r.Binary(), args...)
+}
+
+// InfoCommand returns a command that prints the version of the daemon, or of podman
+// itself since it has no daemon. it fails when the runtime can't run containers.
+func (r Runtime) InfoCommand() exec.Cmd {
+	if r == Podman {
+		return r.Command("info", "--format", "{{.Version.Version}}")
+	}
+
+	return r.Command("info", "--format", "{{.ServerVersion}}")
+}
+
+// Spec describes a container to run in the background
+type Spec struct {
+	Name  string
+	Image string
+
+	// Ports published on the host
+	Ports []Port
+
+	Env     map[string]string
+	Labels  map[string]string
+	Volumes []Volume
+
+	// Network the container is attached to, the default network of the runtime when it's empty
+	Network string
+
+	// Memory limit in bytes, no limit when it's 0
+	Memory int64
+
+	// CPUs limit, no limit when it's 0
+	CPUs float64
+}
+
+type Port struct {
+	Host      int
+	Container int
+}
+
+// Volume is a named volume mounted on the path in the container, the runtime creates it if it doesn't exist
+type Volume struct {
+	Name string
+	Path string
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Container is a container found by its labels
+type Container struct {
+	Name   string
+	Labels map[string]string
+
+	// Runtime the container runs with
+	Runtime Runtime
+}
+
+// List returns the containers with the label, also the stopped ones
+func (r Runtime) List(ctx context.Context, runner exec.Runner, label string) ([]Container, error) {
+	res, err := runner.Run(ctx, r.Command("ps", "-a", "-q", "--filter", fmt.Sprintf("label=%s", label)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	ids := strings.Fields(string(res.Stdout))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// docker prefixes the names with a slash and podman doesn't
+	args := append([]string{"container", "inspect", "--format", "{{.Name}}\t{{json .Config.Labels}}"}, ids...)
+	res, err = runner.Run(ctx, r.Command(args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect containers: %w", err)
+	}
+
+	var containers []Container
+	for _, line := range strings.Split(strings.TrimSpace(string(res.Stdout)), "\n") {
+		name, labels, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected inspect output %q", line)
+		}
+
+		c := Container{Name: strings.TrimPrefix(name, "/"), Runtime: r}
+		err := json.Unmarshal([]byte(labels), &c.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode labels of container %s: %w", c.Name, err)
+		}
+
+		containers = append(containers, c)
+	}
+
+	return containers, nil
+}
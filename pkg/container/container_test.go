@@ -0,0 +1,32 @@
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+
+	runner := exec.NewFakeRunner().
+		On("docker ps -a -q --filter label=env", exec.Result{Stdout: []byte("1a2b\n3c4d\n")}, nil).
+		On("docker container inspect", exec.Result{
+			Stdout: []byte("/gitea\t{\"env\":\"integration\"}\n/k3d-integration-server-0\t{\"env\":\"integration\",\"k3d.cluster\":\"integration\"}\n"),
+		}, nil)
+
+	containers, err := Docker.List(context.Background(), runner, "env")
+	require.NoError(t, err)
+	require.Equal(t, []Container{
+		{Name: "gitea", Labels: map[string]string{"env": "integration"}, Runtime: Docker},
+		{Name: "k3d-integration-server-0", Labels: map[string]string{"env": "integration", "k3d.cluster": "integration"}, Runtime: Docker},
+	}, containers)
+
+	// Nothing is inspected without containers
+	runner = exec.NewFakeRunner()
+	containers, err = Docker.List(context.Background(), runner, "env")
+	require.NoError(t, err)
+	require.Empty(t, containers)
+	require.Len(t, runner.Commands(), 1)
+}
@@ -1,26 +1,131 @@
 package exec
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 )
 
-func LocalExecContext(ctx context.Context, command string, out ...io.Writer) error {
-	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", command)
+// Cmd is a command to run, the args are passed to the process as is without a shell
+// so they don't need to be quoted.
+type Cmd struct {
+	Name string
+	Args []string
 
-	if len(out) > 0 {
-		cmd.Stdout = out[0]
+	Stdin io.Reader
 
-		// TODO: i did it only because flux write the logs to stderr
-		cmd.Stderr = out[0]
+	// Stdout and Stderr receive the output while the command runs, in addition to the Result
+	Stdout io.Writer
+	Stderr io.Writer
 
+	// Env is added to the environment of the current process
+	Env []string
+	Dir string
+}
+
+// Command returns a command that runs name with the args
+func Command(name string, args ...string) Cmd {
+	return Cmd{
+		Name: name,
+		Args: args,
+	}
+}
+
+// String returns the command line of the command
+func (c Cmd) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Result is the output of a command that finished
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Output returns stdout and stderr together, like it's shown in a terminal
+func (r Result) Output() string {
+	return string(r.Stdout) + string(r.Stderr)
+}
+
+// Runner runs commands, the clients get it so they can be tested without docker.
+type Runner interface {
+	Run(ctx context.Context, cmd Cmd) (Result, error)
+}
+
+// ExitError is returned when the command ran but exited with a non zero code
+type ExitError struct {
+	Cmd      string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("%s: exit code %d", e.Cmd, e.ExitCode)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg = fmt.Sprintf("%s: %s", msg, stderr)
+	}
+	return msg
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// LocalRunner runs the commands on this machine
+type LocalRunner struct{}
+
+func NewLocalRunner() *LocalRunner {
+	return &LocalRunner{}
+}
+
+func (r *LocalRunner) Run(ctx context.Context, cmd Cmd) (Result, error) {
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Stdin = cmd.Stdin
+	c.Dir = cmd.Dir
+
+	if len(cmd.Env) > 0 {
+		c.Env = append(c.Environ(), cmd.Env...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+
+	if cmd.Stdout != nil {
+		c.Stdout = io.MultiWriter(&stdout, cmd.Stdout)
+	}
+
+	if cmd.Stderr != nil {
+		c.Stderr = io.MultiWriter(&stderr, cmd.Stderr)
+	}
+
+	err := c.Run()
+
+	res := Result{
+		Stdout: stdout.Bytes(),
+		Stderr: stderr.Bytes(),
 	}
 
-	err := cmd.Run()
 	if err != nil {
-		return fmt.Errorf("local exec: %w", err)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			res.ExitCode = exitErr.ExitCode()
+			return res, &ExitError{
+				Cmd:      cmd.String(),
+				ExitCode: res.ExitCode,
+				Stderr:   stderr.String(),
+				Err:      err,
+			}
+		}
+
+		return res, fmt.Errorf("local exec %s: %w", cmd.Name, err)
 	}
-	return nil
+
+	return res, nil
 }
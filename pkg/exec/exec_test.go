@@ -0,0 +1,73 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalRunner(t *testing.T) {
+
+	runner := NewLocalRunner()
+
+	var stdout bytes.Buffer
+	cmd := Command("sh", "-c", `echo "out with spaces"; echo err >&2`)
+	cmd.Stdout = &stdout
+
+	res, err := runner.Run(context.Background(), cmd)
+	require.NoError(t, err)
+	require.Equal(t, "out with spaces\n", string(res.Stdout))
+	require.Equal(t, "err\n", string(res.Stderr))
+	require.Equal(t, "out with spaces\n", stdout.String())
+
+	res, err = runner.Run(context.Background(), Command("sh", "-c", "echo failed >&2; exit 3"))
+	require.Error(t, err)
+	require.Equal(t, 3, res.ExitCode)
+
+	var exitErr *ExitError
+	require.True(t, errors.As(err, &exitErr))
+	require.Equal(t, 3, exitErr.ExitCode)
+	require.Equal(t, "failed\n", exitErr.Stderr)
+}
+
+func TestFakeRunner(t *testing.T) {
+
+	runner := NewFakeRunner().
+		On("docker image inspect", Result{Stdout: []byte("sha256:123\n")}, nil).
+		OnExit("docker container inspect", 1, "Error: No such container: gitea")
+
+	res, err := runner.Run(context.Background(), Command("docker", "image", "inspect", "-f", "{{ .Id }}", "nginx"))
+	require.NoError(t, err)
+	require.Equal(t, "sha256:123\n", string(res.Stdout))
+
+	res, err = runner.Run(context.Background(), Command("docker", "container", "inspect", "gitea"))
+	require.Error(t, err)
+	require.Equal(t, 1, res.ExitCode)
+	require.Contains(t, res.Output(), "No such container")
+
+	_, err = runner.Run(context.Background(), Command("kubectl", "apply", "-f", "crd.yaml"))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"docker image inspect -f {{ .Id }} nginx",
+		"docker container inspect gitea",
+		"kubectl apply -f crd.yaml",
+	}, runner.Commands())
+}
+
+func TestTraceRunner(t *testing.T) {
+	var out bytes.Buffer
+
+	r := NewTraceRunner(NewFakeRunner())
+	_, err := r.Run(context.Background(), Command("docker", "ps"))
+	require.NoError(t, err)
+	require.Empty(t, out.String())
+
+	r.Out = &out
+	_, err = r.Run(context.Background(), Command("docker", "ps", "-a"))
+	require.NoError(t, err)
+	require.Equal(t, "+ docker ps -a\n", out.String())
+}
@@ -0,0 +1,86 @@
+package exec
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeRunner records the commands it gets and answers them with scripted responses,
+// it's used to test the clients without running anything.
+type FakeRunner struct {
+	mu        sync.Mutex
+	commands  []Cmd
+	responses []fakeResponse
+}
+
+type fakeResponse struct {
+	prefix string
+	res    Result
+	err    error
+}
+
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// On scripts the response for the commands whose command line starts with prefix.
+// the first matching response is used, commands without a response succeed with no output.
+func (f *FakeRunner) On(prefix string, res Result, err error) *FakeRunner {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses = append(f.responses, fakeResponse{
+		prefix: prefix,
+		res:    res,
+		err:    err,
+	})
+
+	return f
+}
+
+// OnExit scripts a command that fails with the exit code and stderr
+func (f *FakeRunner) OnExit(prefix string, exitCode int, stderr string) *FakeRunner {
+	return f.On(prefix, Result{Stderr: []byte(stderr), ExitCode: exitCode}, &ExitError{
+		Cmd:      prefix,
+		ExitCode: exitCode,
+		Stderr:   stderr,
+	})
+}
+
+func (f *FakeRunner) Run(ctx context.Context, cmd Cmd) (Result, error) {
+	f.mu.Lock()
+	f.commands = append(f.commands, cmd)
+
+	var resp fakeResponse
+	for _, r := range f.responses {
+		if strings.HasPrefix(cmd.String(), r.prefix) {
+			resp = r
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if cmd.Stdout != nil {
+		cmd.Stdout.Write(resp.res.Stdout)
+	}
+
+	if cmd.Stderr != nil {
+		cmd.Stderr.Write(resp.res.Stderr)
+	}
+
+	return resp.res, resp.err
+}
+
+// Commands returns the command lines that were run, by order
+func (f *FakeRunner) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var commands []string
+	for _, cmd := range f.commands {
+		commands = append(commands, cmd.String())
+	}
+
+	return commands
+}
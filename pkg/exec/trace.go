@@ -0,0 +1,29 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// TraceRunner prints the command lines before running them, it's used for verbose output.
+type TraceRunner struct {
+	runner Runner
+
+	// Out receives the command lines, nothing is printed when it's nil
+	Out io.Writer
+}
+
+func NewTraceRunner(runner Runner) *TraceRunner {
+	return &TraceRunner{
+		runner: runner,
+	}
+}
+
+func (r *TraceRunner) Run(ctx context.Context, cmd Cmd) (Result, error) {
+	if r.Out != nil {
+		fmt.Fprintf(r.Out, "+ %s\n", cmd.String())
+	}
+
+	return r.runner.Run(ctx, cmd)
+}
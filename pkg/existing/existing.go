@@ -0,0 +1,145 @@
+package existing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ezratameno/integration/pkg/cluster"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// Client uses a cluster which already exists, of a context in the kubeconfig.
+// the cluster is never created or deleted, and the images are not loaded to it.
+// the cluster has to reach the gitea container on the outbound ip of this host.
+type Client struct {
+	kubeContext string
+	out         io.Writer
+}
+
+func NewClient(kubeContext string, out io.Writer) *Client {
+	return &Client{
+		kubeContext: kubeContext,
+		out:         out,
+	}
+}
+
+// CurrentContext returns the current context of the kubeconfig
+func CurrentContext() (string, error) {
+	cfg, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	if cfg.CurrentContext == "" {
+		return "", fmt.Errorf("kubeconfig has no current context")
+	}
+
+	return cfg.CurrentContext, nil
+}
+
+func (c *Client) Name() string {
+	return "existing"
+}
+
+// Create validates that the cluster of the context can be reached, the name and the config are not used
+func (c *Client) Create(ctx context.Context, name string, configPath string, labels map[string]string) error {
+	version, err := c.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "using the existing cluster of context %s, kubernetes %s \n", c.kubeContext, version)
+
+	return nil
+}
+
+// Validate checks that the context is in the kubeconfig and that its api server can be reached,
+// the version of the api server is returned.
+func (c *Client) Validate(ctx context.Context) (string, error) {
+	if c.kubeContext == "" {
+		return "", fmt.Errorf("no kube context of the existing cluster")
+	}
+
+	cfg, err := config.GetConfigWithContext(c.kubeContext)
+	if err != nil {
+		return "", fmt.Errorf("failed to get kubeconfig of context %s: %w", c.kubeContext, err)
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	version, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to reach the cluster of context %s: %w", c.kubeContext, err)
+	}
+
+	return version.GitVersion, nil
+}
+
+// Delete doesn't delete the cluster, flux and the applied manifests are left in it
+func (c *Client) Delete(ctx context.Context, name string) error {
+	fmt.Fprintf(c.out, "the existing cluster of context %s is not deleted \n", c.kubeContext)
+	return nil
+}
+
+// Exists checks if the context is in the kubeconfig
+func (c *Client) Exists(ctx context.Context, name string) (bool, error) {
+	cfg, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return false, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	_, ok := cfg.Contexts[c.kubeContext]
+	return ok, nil
+}
+
+// LoadImages doesn't load the images, the cluster has to pull them from a registry
+func (c *Client) LoadImages(ctx context.Context, opts cluster.LoadImagesOpts) error {
+	if len(opts.Images) > 0 {
+		fmt.Fprintf(c.out, "images are not loaded to the existing cluster of context %s \n", c.kubeContext)
+	}
+
+	return nil
+}
+
+// Kubeconfig returns the kubeconfig with only the context, the credentials files are inlined
+func (c *Client) Kubeconfig(ctx context.Context, name string) ([]byte, error) {
+	cfg, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	cfg.CurrentContext = c.kubeContext
+
+	err = clientcmdapi.MinifyConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = clientcmdapi.FlattenConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientcmd.Write(*cfg)
+}
+
+func (c *Client) KubeContext(name string) string {
+	return c.kubeContext
+}
+
+// Network is empty since the nodes of the existing cluster are not containers
+func (c *Client) Network(name string) string {
+	return ""
+}
+
+// Nodes fails since the nodes of the existing cluster are not containers we can snapshot
+func (c *Client) Nodes(ctx context.Context, name string) ([]string, error) {
+	return nil, fmt.Errorf("the nodes of the existing cluster of context %s are not known", c.kubeContext)
+}
@@ -0,0 +1,65 @@
+package existing
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestKubeconfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(kubeconfig, []byte(`
+apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+- name: prod
+  context:
+    cluster: prod
+    user: prod
+users:
+- name: dev
+  user:
+    token: dev-token
+- name: prod
+  user:
+    token: prod-token
+`), 0600)
+	require.NoError(t, err)
+	t.Setenv("KUBECONFIG", kubeconfig)
+
+	current, err := CurrentContext()
+	require.NoError(t, err)
+	require.Equal(t, "dev", current)
+
+	c := NewClient("prod", io.Discard)
+
+	exists, err := c.Exists(context.Background(), "")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	body, err := c.Kubeconfig(context.Background(), "")
+	require.NoError(t, err)
+
+	cfg, err := clientcmd.Load(body)
+	require.NoError(t, err)
+	require.Equal(t, "prod", cfg.CurrentContext)
+	require.Len(t, cfg.Contexts, 1)
+	require.Equal(t, "https://prod.example.com", cfg.Clusters["prod"].Server)
+}
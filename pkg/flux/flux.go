@@ -1,7 +1,6 @@
 package flux
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -9,8 +8,9 @@ import (
 	"strings"
 	"time"
 
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/ezratameno/integration/pkg/exec"
@@ -19,8 +19,11 @@ import (
 	apimeta "github.com/fluxcd/pkg/apis/meta"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -33,19 +36,38 @@ import (
 
 type Client struct {
 	kubeClient client.Client
+	runner     exec.Runner
 	out        io.Writer
 	dy         *dynamic.DynamicClient
+
+	// kubeconfig context to use, the current context is used when empty
+	kubeContext string
 }
 
-func NewClient(out io.Writer) (*Client, error) {
+func NewClient(runner exec.Runner, out io.Writer) (*Client, error) {
 
 	c := &Client{
-		out: out,
+		runner: runner,
+		out:    out,
 	}
 
 	return c, nil
 }
 
+// UseContext sets the kubeconfig context the client works with, it should be called before Initialize.
+func (c *Client) UseContext(kubeContext string) {
+	c.kubeContext = kubeContext
+}
+
+// contextArgs returns the args to pass to the flux cli so it works with the same context
+func (c *Client) contextArgs() []string {
+	if c.kubeContext == "" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("--context=%s", c.kubeContext)}
+}
+
 type BootstrapOpts struct {
 	PrivateKeyPath string
 	Branch         string
@@ -53,10 +75,24 @@ type BootstrapOpts struct {
 	Password       string
 	Username       string
 	Url            string
-	HttpPort       int
 
-	// url to update the gitrepo object
-	GitRepoUrl string
+	// Repos tell how the cluster clones the repos, the GitRepository objects are updated to them
+	Repos RepoOpts
+}
+
+// RepoOpts tell how the cluster clones the repos over http
+type RepoOpts struct {
+	// URL returns the url the cluster clones the repo from
+	URL func(name string) (string, error)
+
+	// Username and Password the cluster clones with, a secret with them is referenced by every
+	// GitRepository. the GitRepositories are left without a secret when they are empty
+	Username string
+	Password string
+
+	// Receiver reconciles the GitRepositories when the repos are pushed, they are labelled
+	// with its name and their namespaces are added to it. empty when there is no receiver
+	Receiver string
 }
 
 func (c *Client) Initialize() error {
@@ -67,16 +103,22 @@ func (c *Client) Initialize() error {
 	_ = sourcev1.AddToScheme(scheme)
 	_ = helmv2.AddToScheme(scheme)
 	_ = kustomizev1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	cfg, err := config.GetConfigWithContext(c.kubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
 
 	// init Kubernetes client
-	kubeClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	kubeClient, err := client.New(cfg, client.Options{Scheme: scheme})
 	if err != nil {
 		return err
 	}
 
 	c.kubeClient = kubeClient
 
-	dy, err := dynamic.NewForConfig(ctrl.GetConfigOrDie())
+	dy, err := dynamic.NewForConfig(cfg)
 	if err != nil {
 		return err
 	}
@@ -92,57 +134,56 @@ func (c *Client) Bootstrap(ctx context.Context, opts BootstrapOpts) error {
 		return err
 	}
 
-	cmd := fmt.Sprintf(`flux bootstrap git --url="ssh://git@%s" --branch="%s" --private-key-file="%s" --path="%s" --password="%s" --username="%s" --token-auth=true`,
-		opts.Url, opts.Branch, opts.PrivateKeyPath, opts.Path, opts.Password, opts.Username)
-
-	// fmt.Println(cmd)
-
-	// Bootstrap flux
-	var buf bytes.Buffer
-
-	cmdCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	// Read from buffer until i get some string that indicate that resource was created
-	go func() {
+	args := []string{"bootstrap", "git",
+		fmt.Sprintf("--url=%s", opts.Url),
+		fmt.Sprintf("--branch=%s", opts.Branch),
+	}
 
-		defer cancel()
-		for {
-			time.Sleep(1 * time.Second)
+	// Without a private key flux pushes over http with the username and password
+	if opts.PrivateKeyPath != "" {
+		args = append(args, fmt.Sprintf("--private-key-file=%s", opts.PrivateKeyPath))
+	}
 
-			s := buf.String()
+	if strings.HasPrefix(opts.Url, "http://") {
+		args = append(args, "--allow-insecure-http=true")
+	}
 
-			if len(s) == 0 {
-				continue
-			}
+	args = append(args,
+		fmt.Sprintf("--path=%s", opts.Path),
+		fmt.Sprintf("--password=%s", opts.Password),
+		fmt.Sprintf("--username=%s", opts.Username),
+		"--token-auth=true",
+	)
 
-			// fmt.Println(s)
+	cmd := exec.Command("flux", append(args, c.contextArgs()...)...)
 
-			if strings.Contains(s, `reconciled sync configuration`) {
-				return
-			}
+	cmdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-		}
-	}()
+	// Stop the bootstrap once the sync configuration is reconciled, flux writes its logs to stderr
+	watcher := newWatchWriter(`reconciled sync configuration`, cancel)
+	cmd.Stdout = watcher
+	cmd.Stderr = watcher
 
-	fmt.Fprintln(c.out, "bootstrapping flux from gitea repo")
-	// TODO: handle better
-	err = exec.LocalExecContext(cmdCtx, cmd, &buf)
-	if err != nil && !strings.Contains(err.Error(), "signal: killed") {
+	fmt.Fprintln(c.out, "bootstrapping flux from git repo")
+	_, err = c.runner.Run(cmdCtx, cmd)
+	if err != nil && !watcher.Found() {
 		return err
 	}
 
 	fmt.Fprintln(c.out, "finish flux bootstrap")
-	go c.KSInformer(ctx, opts.Username, opts.HttpPort)
+	go func() {
+		err := c.KSInformer(ctx, opts.Repos)
+		if err != nil {
+			fmt.Fprintf(c.out, "git repositories informer stopped: %v \n", err)
+		}
+	}()
 
 	// Wait until git repo is in status ready
 
 	fmt.Fprintf(c.out, "Waiting for flux-system to be ready \n")
 
-	err = c.WaitForKs(ctx, types.NamespacedName{
-		Namespace: "flux-system",
-		Name:      "flux-system",
-	})
+	err = c.WaitForKs(ctx, Root)
 
 	if err != nil {
 		return err
@@ -151,7 +192,8 @@ func (c *Client) Bootstrap(ctx context.Context, opts BootstrapOpts) error {
 	return nil
 }
 
-func (c *Client) KSInformer(ctx context.Context, username string, httpPort int) error {
+// KSInformer updates the GitRepository objects to the urls and the credentials of the repos, by the name of their repo
+func (c *Client) KSInformer(ctx context.Context, repos RepoOpts) error {
 
 	dinfomer := dynamicinformer.NewDynamicSharedInformerFactory(c.dy, 2*time.Second).ForResource(schema.GroupVersionResource{
 		Group:    "source.toolkit.fluxcd.io",
@@ -161,7 +203,15 @@ func (c *Client) KSInformer(ctx context.Context, username string, httpPort int)
 
 	ksInformer := dinfomer.Informer()
 
-	ksInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	// The watch errors are logged to our output instead of klog
+	err := ksInformer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		fmt.Fprintf(c.out, "failed to watch git repositories: %v \n", err)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set the watch error handler: %w", err)
+	}
+
+	_, err = ksInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			u, ok := obj.(*unstructured.Unstructured)
 			if !ok {
@@ -171,13 +221,13 @@ func (c *Client) KSInformer(ctx context.Context, username string, httpPort int)
 			var gitRepo sourcev1.GitRepository
 			err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &gitRepo)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Fprintln(c.out, err)
 				return
 			}
 
-			err = c.updateGitRepo(ctx, gitRepo, username, httpPort)
+			err = c.updateGitRepo(ctx, gitRepo, repos)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Fprintln(c.out, err)
 				return
 			}
 
@@ -191,50 +241,115 @@ func (c *Client) KSInformer(ctx context.Context, username string, httpPort int)
 			var gitRepo sourcev1.GitRepository
 			err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &gitRepo)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Fprintln(c.out, err)
 				return
 			}
 
-			err = c.updateGitRepo(ctx, gitRepo, username, httpPort)
+			err = c.updateGitRepo(ctx, gitRepo, repos)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Fprintln(c.out, err)
 			}
 		},
 	})
+	if err != nil {
+		return fmt.Errorf("failed to add the git repositories handler: %w", err)
+	}
 
 	ksInformer.Run(ctx.Done())
 
 	return nil
 }
 
-// updateGitRepo updates the gitrepo url and branch so we can use it
-func (c *Client) updateGitRepo(ctx context.Context, gitRepo sourcev1.GitRepository, username string, httpPort int) error {
+// updateGitRepo updates the gitrepo url, branch and the secret it clones with so we can use it,
+// and labels it so the receiver reconciles it
+func (c *Client) updateGitRepo(ctx context.Context, gitRepo sourcev1.GitRepository, repos RepoOpts) error {
 
-	// Check if we need to update
+	repoName := strings.TrimSuffix(path.Base(gitRepo.Spec.URL), ".git")
 
-	ip, err := getOutboundIP()
+	url, err := repos.URL(repoName)
 	if err != nil {
 		return err
 	}
-	if strings.Contains(gitRepo.Spec.URL, ip.String()) {
+
+	var secretRef *apimeta.LocalObjectReference
+	if repos.Username != "" {
+		secretRef = &apimeta.LocalObjectReference{Name: authSecretName(gitRepo.Name)}
+	}
+
+	// The secret is kept up to date also when the GitRepository is, since the credentials may change
+	if secretRef != nil {
+		err = c.applyAuthSecret(ctx, gitRepo.Namespace, secretRef.Name, repos)
+		if err != nil {
+			return err
+		}
+	}
+
+	if repos.Receiver != "" {
+		err = c.addReceiverNamespace(ctx, repos.Receiver, gitRepo.Namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check if we need to update
+	if gitRepo.Spec.URL == url && gitRepo.Spec.Reference != nil && gitRepo.Spec.Reference.Branch == "main" &&
+		equality.Semantic.DeepEqual(gitRepo.Spec.SecretRef, secretRef) && gitRepo.Labels[ReceiverLabel] == repos.Receiver {
 		return nil
 	}
 
-	repoName := path.Base(gitRepo.Spec.URL)
+	if repos.Receiver != "" {
+		if gitRepo.Labels == nil {
+			gitRepo.Labels = make(map[string]string)
+		}
+		gitRepo.Labels[ReceiverLabel] = repos.Receiver
+	}
 
-	gitRepo.Spec.URL = fmt.Sprintf("http://%s:%d/%s/%s", ip.String(), httpPort, username, repoName)
+	gitRepo.Spec.URL = url
+	gitRepo.Spec.SecretRef = secretRef
+	if gitRepo.Spec.Reference == nil {
+		gitRepo.Spec.Reference = &sourcev1.GitRepositoryRef{}
+	}
 	gitRepo.Spec.Reference.Branch = "main"
 	err = c.kubeClient.Patch(ctx, &gitRepo, client.Merge, &client.PatchOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to patch changes: %w", err)
 	}
 
-	fmt.Printf("update %s url\n", repoName)
+	fmt.Fprintf(c.out, "update %s url\n", repoName)
 
 	return nil
 
 }
 
+// authSecretName returns the name of the secret the GitRepository clones with
+func authSecretName(gitRepo string) string {
+	return fmt.Sprintf("%s-http-auth", gitRepo)
+}
+
+// applyAuthSecret creates or updates the secret with the basic auth credentials of the repos
+func (c *Client) applyAuthSecret(ctx context.Context, namespace, name string, repos RepoOpts) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, c.kubeClient, secret, func() error {
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{
+			"username": []byte(repos.Username),
+			"password": []byte(repos.Password),
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply secret %s/%s: %w", namespace, name, err)
+	}
+
+	return nil
+}
+
 // WaitForKs wait for the kustomization to be ready
 func (c *Client) WaitForKs(ctx context.Context, kss ...types.NamespacedName) error {
 
@@ -244,7 +359,8 @@ func (c *Client) WaitForKs(ctx context.Context, kss ...types.NamespacedName) err
 		namespace string
 	}
 
-	respCh := make(chan Resp)
+	// Buffered so the goroutines don't block when we return on the first error
+	respCh := make(chan Resp, len(kss))
 
 	for _, ks := range kss {
 		go func(client *Client, ks types.NamespacedName) {
@@ -289,6 +405,15 @@ func (c *Client) WaitForKs(ctx context.Context, kss ...types.NamespacedName) err
 }
 
 func (c *Client) ReconcileKS(ctx context.Context, kustomizations ...types.NamespacedName) error {
+	return c.reconcileKS(ctx, false, kustomizations...)
+}
+
+// ReconcileKSWithSource fetches the source of the kustomizations before reconciling them
+func (c *Client) ReconcileKSWithSource(ctx context.Context, kustomizations ...types.NamespacedName) error {
+	return c.reconcileKS(ctx, true, kustomizations...)
+}
+
+func (c *Client) reconcileKS(ctx context.Context, withSource bool, kustomizations ...types.NamespacedName) error {
 
 	type Resp struct {
 		err       error
@@ -296,7 +421,8 @@ func (c *Client) ReconcileKS(ctx context.Context, kustomizations ...types.Namesp
 		namespace string
 	}
 
-	respCh := make(chan Resp)
+	// Buffered so the goroutines don't block when we return on the first error
+	respCh := make(chan Resp, len(kustomizations))
 
 	for _, ks := range kustomizations {
 		go func(c *Client, ks types.NamespacedName) {
@@ -330,13 +456,13 @@ func (c *Client) ReconcileKS(ctx context.Context, kustomizations ...types.Namesp
 			// 	return
 			// }
 
-			var buf bytes.Buffer
-
-			cmd := fmt.Sprintf("flux reconcile ks %s -n %s", ks.Name, ks.Namespace)
-			err := exec.LocalExecContext(ctx, cmd, &buf)
-			if err != nil {
-				err = fmt.Errorf("%s: %w", buf.String(), err)
+			args := []string{"reconcile", "ks", ks.Name, "-n", ks.Namespace}
+			if withSource {
+				args = append(args, "--with-source")
 			}
+
+			cmd := exec.Command("flux", append(args, c.contextArgs()...)...)
+			_, err := c.runner.Run(ctx, cmd)
 			respCh <- Resp{
 				err:       err,
 				name:      ks.Name,
@@ -358,6 +484,18 @@ func (c *Client) ReconcileKS(ctx context.Context, kustomizations ...types.Namesp
 	return nil
 }
 
+// GetKs returns the kustomization
+func (c *Client) GetKs(ctx context.Context, ks types.NamespacedName) (kustomizev1.Kustomization, error) {
+	var kustomization kustomizev1.Kustomization
+
+	err := c.kubeClient.Get(ctx, ks, &kustomization)
+	if err != nil {
+		return kustomization, fmt.Errorf("failed to get kustomization %s: %w", ks, err)
+	}
+
+	return kustomization, nil
+}
+
 func (c *Client) ListKs(ctx context.Context) ([]kustomizev1.Kustomization, error) {
 	var kustomizations kustomizev1.KustomizationList
 
@@ -0,0 +1,65 @@
+package flux
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUpdateGitRepo(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, sourcev1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	gitRepo := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "flux-system", Name: "apps"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       "ssh://git@github.com/org/apps.git",
+			Reference: &sourcev1.GitRepositoryRef{Branch: "develop"},
+		},
+	}
+
+	c := &Client{
+		kubeClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(gitRepo).Build(),
+		out:        io.Discard,
+	}
+
+	repos := RepoOpts{
+		URL: func(name string) (string, error) {
+			return "http://10.0.0.1:3000/admin/" + name + ".git", nil
+		},
+		Username: "admin",
+		Password: "token",
+		Receiver: "gitea",
+	}
+
+	require.NoError(t, c.updateGitRepo(ctx, *gitRepo, repos))
+
+	var updated sourcev1.GitRepository
+	require.NoError(t, c.kubeClient.Get(ctx, types.NamespacedName{Namespace: "flux-system", Name: "apps"}, &updated))
+	require.Equal(t, "http://10.0.0.1:3000/admin/apps.git", updated.Spec.URL)
+	require.Equal(t, "main", updated.Spec.Reference.Branch)
+	require.Equal(t, "apps-http-auth", updated.Spec.SecretRef.Name)
+	require.Equal(t, "gitea", updated.Labels[ReceiverLabel])
+
+	var secret corev1.Secret
+	require.NoError(t, c.kubeClient.Get(ctx, types.NamespacedName{Namespace: "flux-system", Name: "apps-http-auth"}, &secret))
+	require.Equal(t, map[string][]byte{"username": []byte("admin"), "password": []byte("token")}, secret.Data)
+
+	// The secret is updated when the credentials change
+	repos.Password = "new-token"
+	require.NoError(t, c.updateGitRepo(ctx, updated, repos))
+
+	require.NoError(t, c.kubeClient.Get(ctx, types.NamespacedName{Namespace: "flux-system", Name: "apps-http-auth"}, &secret))
+	require.Equal(t, []byte("new-token"), secret.Data["password"])
+}
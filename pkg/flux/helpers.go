@@ -1,16 +1,45 @@
 package flux
 
-import "net"
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
 
-// Get preferred outbound ip of this machine
-func getOutboundIP() (net.IP, error) {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		return nil, err
+// watchWriter calls found once the text shows up in the output written to it
+type watchWriter struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	text  string
+	found func()
+	seen  bool
+}
+
+func newWatchWriter(text string, found func()) *watchWriter {
+	return &watchWriter{
+		text:  text,
+		found: found,
 	}
-	defer conn.Close()
+}
+
+func (w *watchWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+
+	if !w.seen && strings.Contains(w.buf.String(), w.text) {
+		w.seen = true
+		w.found()
+	}
+
+	return len(p), nil
+}
 
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
+// Found returns true if the text was written
+func (w *watchWriter) Found() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	return localAddr.IP, nil
+	return w.seen
 }
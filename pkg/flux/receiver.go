@@ -0,0 +1,251 @@
+package flux
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// ReceiverNamespace is where the receiver and the service which exposes it are created
+	ReceiverNamespace = "flux-system"
+
+	// ReceiverLabel marks the GitRepositories the receiver reconciles, its value is the name of the receiver
+	ReceiverLabel = "integration.ezratameno.io/receiver"
+
+	// receiverService exposes the webhook receiver of the notification controller on a node port
+	receiverService = "webhook-receiver-nodeport"
+)
+
+// receiverGVK is served since flux 2.1
+var receiverGVK = schema.GroupVersionKind{
+	Group:   "notification.toolkit.fluxcd.io",
+	Version: "v1",
+	Kind:    "Receiver",
+}
+
+func newReceiver(name string) *unstructured.Unstructured {
+	receiver := &unstructured.Unstructured{}
+	receiver.SetGroupVersionKind(receiverGVK)
+	receiver.SetNamespace(ReceiverNamespace)
+	receiver.SetName(name)
+
+	return receiver
+}
+
+// receiverResource selects the labelled GitRepositories of the namespace
+func receiverResource(name, namespace string) map[string]any {
+	return map[string]any{
+		"kind":        "GitRepository",
+		"name":        "*",
+		"namespace":   namespace,
+		"matchLabels": map[string]any{ReceiverLabel: name},
+	}
+}
+
+// CreateReceiver creates a generic receiver which reconciles the GitRepositories labelled with its name,
+// the GitRepositories of other namespaces are added to it by KSInformer. the token of an existing receiver
+// is kept so the webhooks which call it keep working. it returns the path the receiver is called on.
+func (c *Client) CreateReceiver(ctx context.Context, name string) (string, error) {
+
+	secretName := fmt.Sprintf("%s-webhook-token", name)
+
+	err := c.ensureReceiverToken(ctx, secretName)
+	if err != nil {
+		return "", err
+	}
+
+	receiver := newReceiver(name)
+	_, err = controllerutil.CreateOrUpdate(ctx, c.kubeClient, receiver, func() error {
+		resources, _, err := unstructured.NestedSlice(receiver.Object, "spec", "resources")
+		if err != nil {
+			return err
+		}
+
+		if !hasResource(resources, ReceiverNamespace) {
+			resources = append(resources, receiverResource(name, ReceiverNamespace))
+		}
+
+		return unstructured.SetNestedField(receiver.Object, map[string]any{
+			"type":      "generic",
+			"secretRef": map[string]any{"name": secretName},
+			"resources": resources,
+		}, "spec")
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to apply receiver %s: %w", name, err)
+	}
+
+	fmt.Fprintf(c.out, "waiting for receiver %s to be ready \n", name)
+
+	var webhookPath string
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, 2*time.Minute, true, func(ctx context.Context) (bool, error) {
+		err := c.kubeClient.Get(ctx, client.ObjectKeyFromObject(receiver), receiver)
+		if err != nil {
+			return false, err
+		}
+
+		webhookPath, _, err = unstructured.NestedString(receiver.Object, "status", "webhookPath")
+		return webhookPath != "", err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to wait for the webhook path of receiver %s: %w", name, err)
+	}
+
+	return webhookPath, nil
+}
+
+// ensureReceiverToken creates the secret with the token of the receiver, if it doesn't exist
+func (c *Client) ensureReceiverToken(ctx context.Context, secretName string) error {
+	var secret corev1.Secret
+	err := c.kubeClient.Get(ctx, types.NamespacedName{Namespace: ReceiverNamespace, Name: secretName}, &secret)
+	if err == nil {
+		return nil
+	}
+
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get secret %s: %w", secretName, err)
+	}
+
+	token := make([]byte, 32)
+	_, err = rand.Read(token)
+	if err != nil {
+		return fmt.Errorf("failed to generate receiver token: %w", err)
+	}
+
+	secret = corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ReceiverNamespace,
+			Name:      secretName,
+		},
+		StringData: map[string]string{
+			"token": hex.EncodeToString(token),
+		},
+	}
+
+	err = c.kubeClient.Create(ctx, &secret)
+	if err != nil {
+		return fmt.Errorf("failed to create secret %s: %w", secretName, err)
+	}
+
+	return nil
+}
+
+// addReceiverNamespace adds the labelled GitRepositories of the namespace to the receiver,
+// it does nothing until the receiver is created.
+func (c *Client) addReceiverNamespace(ctx context.Context, name, namespace string) error {
+	receiver := newReceiver(name)
+	err := c.kubeClient.Get(ctx, client.ObjectKeyFromObject(receiver), receiver)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	resources, _, err := unstructured.NestedSlice(receiver.Object, "spec", "resources")
+	if err != nil {
+		return err
+	}
+
+	if hasResource(resources, namespace) {
+		return nil
+	}
+
+	resources = append(resources, receiverResource(name, namespace))
+	err = unstructured.SetNestedSlice(receiver.Object, resources, "spec", "resources")
+	if err != nil {
+		return err
+	}
+
+	err = c.kubeClient.Update(ctx, receiver)
+	if err != nil {
+		return fmt.Errorf("failed to add namespace %s to receiver %s: %w", namespace, name, err)
+	}
+
+	return nil
+}
+
+// hasResource checks if the resources of the receiver select the GitRepositories of the namespace
+func hasResource(resources []any, namespace string) bool {
+	for _, resource := range resources {
+		r, ok := resource.(map[string]any)
+		if ok && r["kind"] == "GitRepository" && r["namespace"] == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExposeReceiver exposes the webhook receiver of the notification controller on a node port,
+// it returns the address of the receiver on the internal ip of the first node.
+func (c *Client) ExposeReceiver(ctx context.Context) (string, error) {
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ReceiverNamespace,
+			Name:      receiverService,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, c.kubeClient, service, func() error {
+		service.Spec.Type = corev1.ServiceTypeNodePort
+		service.Spec.Selector = map[string]string{"app": "notification-controller"}
+
+		// Keep the node port which was allocated
+		var nodePort int32
+		if len(service.Spec.Ports) > 0 {
+			nodePort = service.Spec.Ports[0].NodePort
+		}
+
+		service.Spec.Ports = []corev1.ServicePort{{
+			Name:       "http",
+			Port:       80,
+			TargetPort: intstr.FromString("http-webhook"),
+			NodePort:   nodePort,
+		}}
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to apply service %s: %w", receiverService, err)
+	}
+
+	ip, err := c.nodeIP(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("http://%s:%d", ip, service.Spec.Ports[0].NodePort), nil
+}
+
+// nodeIP returns the internal ip of the first node, for the clusters of containers it's the ip
+// of the node container in the network of the cluster
+func (c *Client) nodeIP(ctx context.Context) (string, error) {
+	var nodes corev1.NodeList
+	err := c.kubeClient.List(ctx, &nodes)
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	for _, node := range nodes.Items {
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeInternalIP {
+				return address.Address, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no node has an internal ip")
+}
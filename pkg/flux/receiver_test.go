@@ -0,0 +1,116 @@
+package flux
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newFakeClient(t *testing.T, objs ...client.Object) *Client {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	return &Client{
+		kubeClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		out:        io.Discard,
+	}
+}
+
+func TestCreateReceiver(t *testing.T) {
+	ctx := context.Background()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ReceiverNamespace, Name: "gitea-webhook-token"},
+		Data:       map[string][]byte{"token": []byte("existing")},
+	}
+
+	// The notification controller sets the path once the receiver is ready
+	receiver := newReceiver("gitea")
+	require.NoError(t, unstructured.SetNestedField(receiver.Object, "/hook/abc", "status", "webhookPath"))
+
+	c := newFakeClient(t, secret, receiver)
+
+	webhookPath, err := c.CreateReceiver(ctx, "gitea")
+	require.NoError(t, err)
+	require.Equal(t, "/hook/abc", webhookPath)
+
+	// The webhooks keep working with the existing token
+	require.NoError(t, c.kubeClient.Get(ctx, client.ObjectKeyFromObject(secret), secret))
+	require.Equal(t, []byte("existing"), secret.Data["token"])
+
+	require.NoError(t, c.kubeClient.Get(ctx, client.ObjectKeyFromObject(receiver), receiver))
+	secretName, _, err := unstructured.NestedString(receiver.Object, "spec", "secretRef", "name")
+	require.NoError(t, err)
+	require.Equal(t, "gitea-webhook-token", secretName)
+
+	// A new receiver gets a new token
+	require.NoError(t, c.ensureReceiverToken(ctx, "other-webhook-token"))
+
+	var created corev1.Secret
+	require.NoError(t, c.kubeClient.Get(ctx, types.NamespacedName{Namespace: ReceiverNamespace, Name: "other-webhook-token"}, &created))
+	require.Len(t, created.StringData["token"], 64)
+}
+
+func TestAddReceiverNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	receiver := newReceiver("gitea")
+	require.NoError(t, unstructured.SetNestedSlice(receiver.Object, []any{receiverResource("gitea", ReceiverNamespace)}, "spec", "resources"))
+
+	c := newFakeClient(t, receiver)
+
+	require.NoError(t, c.addReceiverNamespace(ctx, "gitea", "apps"))
+	require.NoError(t, c.addReceiverNamespace(ctx, "gitea", "apps"))
+	require.NoError(t, c.addReceiverNamespace(ctx, "gitea", ReceiverNamespace))
+
+	require.NoError(t, c.kubeClient.Get(ctx, client.ObjectKeyFromObject(receiver), receiver))
+	resources, _, err := unstructured.NestedSlice(receiver.Object, "spec", "resources")
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	require.True(t, hasResource(resources, "apps"))
+
+	// Nothing is done until the receiver is created
+	require.NoError(t, c.addReceiverNamespace(ctx, "missing", "apps"))
+}
+
+func TestExposeReceiver(t *testing.T) {
+	ctx := context.Background()
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ReceiverNamespace, Name: receiverService},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80, NodePort: 31234}},
+		},
+	}
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "integration-control-plane"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "integration-control-plane"},
+				{Type: corev1.NodeInternalIP, Address: "172.18.0.2"},
+			},
+		},
+	}
+
+	c := newFakeClient(t, service, node)
+
+	// The allocated node port is kept so the webhooks keep working
+	addr, err := c.ExposeReceiver(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "http://172.18.0.2:31234", addr)
+
+	require.NoError(t, c.kubeClient.Get(ctx, client.ObjectKeyFromObject(service), service))
+	require.Equal(t, int32(31234), service.Spec.Ports[0].NodePort)
+	require.Equal(t, map[string]string{"app": "notification-controller"}, service.Spec.Selector)
+}
@@ -0,0 +1,395 @@
+package flux
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2beta2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// kustomizationFiles are the names kustomize looks for in a directory
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+type ParseRepoOpts struct {
+	// RepoPath is the local repo flux is bootstrapped from
+	RepoPath string
+
+	// Path in the repo flux is bootstrapped from
+	Path string
+
+	// LocalRepos are the paths of the local repos pushed to gitea, the GitRepositories
+	// are matched to them by the name of the repo in their url.
+	LocalRepos []string
+}
+
+// Repo holds the flux objects found in the local repos
+type Repo struct {
+	Kustomizations  []kustomizev1.Kustomization
+	HelmReleases    []helmv2.HelmRelease
+	GitRepositories []sourcev1.GitRepository
+
+	// MissingRepos are the urls of the GitRepositories which are not local repos
+	MissingRepos []string
+
+	// Problems are references to objects which were not found, like a missing dependency
+	Problems []string
+
+	// Skipped are the remote resources of kustomization.yaml files which are not read
+	Skipped []string
+}
+
+// ParseRepo discovers the flux objects of the bootstrap path without a cluster, it follows
+// the resources of kustomization.yaml files and the paths of the flux Kustomizations like flux would.
+func ParseRepo(opts ParseRepoOpts) (*Repo, error) {
+	p := &repoParser{
+		opts:    opts,
+		repo:    &Repo{},
+		visited: make(map[string]bool),
+	}
+
+	err := p.parseDir(filepath.Join(opts.RepoPath, opts.Path), "")
+	if err != nil {
+		return nil, err
+	}
+
+	// The kustomizations can come before their source, so they are followed once all the sources are known.
+	// every kustomization may add more kustomizations and sources.
+	for i := 0; i < len(p.repo.Kustomizations); i++ {
+		err := p.followKs(p.repo.Kustomizations[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.validate()
+
+	return p.repo, nil
+}
+
+type repoParser struct {
+	opts ParseRepoOpts
+	repo *Repo
+
+	// visited dirs and files, they can be reached from multiple kustomizations
+	visited map[string]bool
+}
+
+// parseDir reads the objects of a dir like kustomize build does, when the dir has no
+// kustomization.yaml all the yaml files under it are read like flux does.
+func (p *repoParser) parseDir(dir string, namespace string) error {
+	if p.visited[dir] {
+		return nil
+	}
+	p.visited[dir] = true
+
+	kustomization, err := readKustomization(dir)
+	if err != nil {
+		return err
+	}
+
+	if kustomization == nil {
+		return p.parseTree(dir, namespace)
+	}
+
+	// The namespace of the parent is applied last so it overrides the one of the kustomization.yaml
+	if namespace == "" {
+		namespace = kustomization.Namespace
+	}
+
+	for _, resource := range append(kustomization.Resources, kustomization.Bases...) {
+		if strings.Contains(resource, "://") || strings.HasPrefix(resource, "github.com/") {
+			p.repo.Skipped = append(p.repo.Skipped, resource)
+			continue
+		}
+
+		resourcePath := filepath.Join(dir, resource)
+		info, err := os.Stat(resourcePath)
+		if err != nil {
+			return fmt.Errorf("failed to read resource %s of %s: %w", resource, dir, err)
+		}
+
+		if info.IsDir() {
+			err = p.parseDir(resourcePath, namespace)
+		} else {
+			err = p.parseFile(resourcePath, namespace)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseTree reads all the yaml files under dir, the dirs with a kustomization.yaml are built by it
+func (p *repoParser) parseTree(dir string, namespace string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read dir %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dir, entry.Name())
+
+		if entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			err = p.parseDir(entryPath, namespace)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if filepath.Ext(entry.Name()) != ".yaml" && filepath.Ext(entry.Name()) != ".yml" {
+			continue
+		}
+
+		err = p.parseFile(entryPath, namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseFile reads the flux objects of a yaml file, the other objects are ignored
+func (p *repoParser) parseFile(file string, namespace string) error {
+	if p.visited[file] {
+		return nil
+	}
+	p.visited[file] = true
+
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(body)))
+	for {
+		doc, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		var typeMeta struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+
+		// Not every yaml file is a kubernetes object, like helm values
+		err = yaml.Unmarshal(doc, &typeMeta)
+		if err != nil {
+			continue
+		}
+
+		group := strings.Split(typeMeta.APIVersion, "/")[0]
+
+		switch {
+		case group == kustomizev1.GroupVersion.Group && typeMeta.Kind == kustomizev1.KustomizationKind:
+			var ks kustomizev1.Kustomization
+			err = yaml.Unmarshal(doc, &ks)
+			ks.Namespace = objectNamespace(ks.Namespace, namespace)
+			p.repo.Kustomizations = append(p.repo.Kustomizations, ks)
+
+		case group == helmv2.GroupVersion.Group && typeMeta.Kind == helmv2.HelmReleaseKind:
+			var hr helmv2.HelmRelease
+			err = yaml.Unmarshal(doc, &hr)
+			hr.Namespace = objectNamespace(hr.Namespace, namespace)
+			p.repo.HelmReleases = append(p.repo.HelmReleases, hr)
+
+		case group == sourcev1.GroupVersion.Group && typeMeta.Kind == sourcev1.GitRepositoryKind:
+			var gitRepo sourcev1.GitRepository
+			err = yaml.Unmarshal(doc, &gitRepo)
+			gitRepo.Namespace = objectNamespace(gitRepo.Namespace, namespace)
+			p.repo.GitRepositories = append(p.repo.GitRepositories, gitRepo)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to decode %s %s: %w", typeMeta.Kind, file, err)
+		}
+	}
+}
+
+// followKs reads the path of the kustomization from its source
+func (p *repoParser) followKs(ks kustomizev1.Kustomization) error {
+	if ks.Spec.SourceRef.Kind != sourcev1.GitRepositoryKind {
+		return nil
+	}
+
+	source := types.NamespacedName{
+		Namespace: refNamespace(ks.Spec.SourceRef.Namespace, ks.Namespace),
+		Name:      ks.Spec.SourceRef.Name,
+	}
+
+	repoPath, ok := p.sourcePath(source)
+	if !ok {
+		return nil
+	}
+
+	ksPath := filepath.Join(repoPath, ks.Spec.Path)
+	if _, err := os.Stat(ksPath); err != nil {
+		p.repo.Problems = append(p.repo.Problems, fmt.Sprintf("kustomization %s/%s: path %s not found in %s", ks.Namespace, ks.Name, ks.Spec.Path, repoPath))
+		return nil
+	}
+
+	return p.parseDir(ksPath, ks.Spec.TargetNamespace)
+}
+
+// sourcePath returns the local repo of the GitRepository
+func (p *repoParser) sourcePath(source types.NamespacedName) (string, bool) {
+	if source == Root {
+		return p.opts.RepoPath, true
+	}
+
+	for _, gitRepo := range p.repo.GitRepositories {
+		if gitRepo.Namespace != source.Namespace || gitRepo.Name != source.Name {
+			continue
+		}
+
+		return p.localRepo(gitRepo.Spec.URL)
+	}
+
+	return "", false
+}
+
+// localRepo returns the local repo the url points at, by the name of the repo
+func (p *repoParser) localRepo(url string) (string, bool) {
+	name := strings.TrimSuffix(path.Base(url), ".git")
+
+	for _, repoPath := range p.opts.LocalRepos {
+		if path.Base(repoPath) == name {
+			return repoPath, true
+		}
+	}
+
+	return "", false
+}
+
+// validate checks that the objects the flux objects reference were found
+func (p *repoParser) validate() {
+	sources := map[types.NamespacedName]bool{
+		Root: true,
+	}
+
+	for _, gitRepo := range p.repo.GitRepositories {
+		sources[types.NamespacedName{Namespace: gitRepo.Namespace, Name: gitRepo.Name}] = true
+
+		if _, ok := p.localRepo(gitRepo.Spec.URL); !ok {
+			p.repo.MissingRepos = append(p.repo.MissingRepos, gitRepo.Spec.URL)
+		}
+	}
+
+	kss := make(map[types.NamespacedName]bool)
+	for _, ks := range p.repo.Kustomizations {
+		kss[types.NamespacedName{Namespace: ks.Namespace, Name: ks.Name}] = true
+	}
+
+	hrs := make(map[types.NamespacedName]bool)
+	for _, hr := range p.repo.HelmReleases {
+		hrs[types.NamespacedName{Namespace: hr.Namespace, Name: hr.Name}] = true
+	}
+
+	for _, ks := range p.repo.Kustomizations {
+		source := types.NamespacedName{
+			Namespace: refNamespace(ks.Spec.SourceRef.Namespace, ks.Namespace),
+			Name:      ks.Spec.SourceRef.Name,
+		}
+
+		if ks.Spec.SourceRef.Kind == sourcev1.GitRepositoryKind && !sources[source] {
+			p.repo.Problems = append(p.repo.Problems, fmt.Sprintf("kustomization %s/%s: source GitRepository %s not found", ks.Namespace, ks.Name, source))
+		}
+
+		for _, d := range ks.Spec.DependsOn {
+			dep := types.NamespacedName{Namespace: refNamespace(d.Namespace, ks.Namespace), Name: d.Name}
+			if !kss[dep] {
+				p.repo.Problems = append(p.repo.Problems, fmt.Sprintf("kustomization %s/%s: dependency %s not found", ks.Namespace, ks.Name, dep))
+			}
+		}
+	}
+
+	for _, hr := range p.repo.HelmReleases {
+		for _, d := range hr.Spec.DependsOn {
+			dep := types.NamespacedName{Namespace: refNamespace(d.Namespace, hr.Namespace), Name: d.Name}
+			if !hrs[dep] {
+				p.repo.Problems = append(p.repo.Problems, fmt.Sprintf("helmrelease %s/%s: dependency %s not found", hr.Namespace, hr.Name, dep))
+			}
+		}
+	}
+
+	sort.Strings(p.repo.MissingRepos)
+	sort.Strings(p.repo.Problems)
+}
+
+type kustomizationFile struct {
+	Namespace string   `json:"namespace"`
+	Resources []string `json:"resources"`
+	Bases     []string `json:"bases"`
+}
+
+// readKustomization reads the kustomization.yaml of the dir, it returns nil when there is none
+func readKustomization(dir string) (*kustomizationFile, error) {
+	for _, name := range kustomizationFiles {
+		body, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		var kustomization kustomizationFile
+		err = yaml.Unmarshal(body, &kustomization)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", filepath.Join(dir, name), err)
+		}
+
+		return &kustomization, nil
+	}
+
+	return nil, nil
+}
+
+// refNamespace returns the namespace of a referenced object, without a namespace
+// it's in the namespace of the object referencing it.
+func refNamespace(namespace string, objNamespace string) string {
+	if namespace == "" {
+		return objNamespace
+	}
+
+	return namespace
+}
+
+// objectNamespace returns the namespace of an object, the namespace set by a kustomization
+// overrides it and objects without a namespace are created in the default namespace.
+func objectNamespace(namespace string, override string) string {
+	if override != "" {
+		return override
+	}
+
+	if namespace == "" {
+		return "default"
+	}
+
+	return namespace
+}
@@ -0,0 +1,122 @@
+package flux
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, body := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(body), 0644))
+	}
+}
+
+func TestParseRepo(t *testing.T) {
+	dir := t.TempDir()
+	fleet := filepath.Join(dir, "fleet")
+	apps := filepath.Join(dir, "apps")
+
+	writeFiles(t, fleet, map[string]string{
+		"clusters/dev/kustomization.yaml": `
+resources:
+  - infra.yaml
+  - apps.yaml
+  - https://github.com/org/repo/base
+`,
+		"clusters/dev/infra.yaml": `
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: infra
+  namespace: flux-system
+spec:
+  path: ./infra
+  sourceRef:
+    kind: GitRepository
+    name: flux-system
+`,
+		"clusters/dev/apps.yaml": `
+apiVersion: source.toolkit.fluxcd.io/v1
+kind: GitRepository
+metadata:
+  name: apps
+  namespace: flux-system
+spec:
+  url: ssh://git@github.com/org/apps.git
+---
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: apps
+  namespace: flux-system
+spec:
+  path: ./deploy
+  dependsOn:
+    - name: infra
+    - name: missing
+  sourceRef:
+    kind: GitRepository
+    name: apps
+`,
+		// Not in the kustomization.yaml so it's not read
+		"clusters/dev/ignored.yaml": `
+apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: ignored
+`,
+		"infra/repos.yaml": `
+apiVersion: source.toolkit.fluxcd.io/v1
+kind: GitRepository
+metadata:
+  name: charts
+  namespace: flux-system
+spec:
+  url: https://github.com/org/charts
+`,
+	})
+
+	writeFiles(t, apps, map[string]string{
+		"deploy/nested/release.yaml": `
+apiVersion: helm.toolkit.fluxcd.io/v2beta2
+kind: HelmRelease
+metadata:
+  name: podinfo
+spec:
+  dependsOn:
+    - name: redis
+`,
+		"deploy/values.yaml": `
+- not an object
+`,
+	})
+
+	repo, err := ParseRepo(ParseRepoOpts{
+		RepoPath:   fleet,
+		Path:       "clusters/dev",
+		LocalRepos: []string{fleet, apps},
+	})
+	require.NoError(t, err)
+
+	var kss []string
+	for _, ks := range repo.Kustomizations {
+		kss = append(kss, ks.Namespace+"/"+ks.Name)
+	}
+	require.ElementsMatch(t, []string{"flux-system/infra", "flux-system/apps"}, kss)
+
+	require.Len(t, repo.HelmReleases, 1)
+	require.Equal(t, "default", repo.HelmReleases[0].Namespace)
+	require.Len(t, repo.GitRepositories, 2)
+
+	require.Equal(t, []string{"https://github.com/org/charts"}, repo.MissingRepos)
+	require.Equal(t, []string{
+		"helmrelease default/podinfo: dependency default/redis not found",
+		"kustomization flux-system/apps: dependency flux-system/missing not found",
+	}, repo.Problems)
+	require.Equal(t, []string{"https://github.com/org/repo/base"}, repo.Skipped)
+}
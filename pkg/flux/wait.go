@@ -0,0 +1,227 @@
+package flux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2beta2"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	apimeta "github.com/fluxcd/pkg/apis/meta"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// The labels kustomize-controller sets on the objects it applies
+const (
+	ksNameLabel      = "kustomize.toolkit.fluxcd.io/name"
+	ksNamespaceLabel = "kustomize.toolkit.fluxcd.io/namespace"
+)
+
+// Root is the kustomization and the GitRepository flux bootstrap creates, the GitRepository points at
+// the bootstrap repo and all the other objects are created under the kustomization
+var Root = types.NamespacedName{
+	Namespace: "flux-system",
+	Name:      "flux-system",
+}
+
+// treeObject is a Kustomization or a HelmRelease of the tree
+type treeObject struct {
+	kind       string
+	name       types.NamespacedName
+	parent     *types.NamespacedName
+	generation int64
+	conditions []metav1.Condition
+
+	// observedGeneration of the status, the conditions are of an older spec when it's behind
+	observedGeneration int64
+}
+
+func (o treeObject) String() string {
+	return fmt.Sprintf("%s %s", o.kind, o.name)
+}
+
+// ready checks that the object was reconciled with its latest spec
+func (o treeObject) ready() bool {
+	return o.observedGeneration == o.generation && meta.IsStatusConditionTrue(o.conditions, apimeta.ReadyCondition)
+}
+
+// failed checks if the object failed in a way it won't recover from without a change
+func (o treeObject) failed() (string, bool) {
+	if o.observedGeneration != o.generation {
+		return "", false
+	}
+
+	if cond := meta.FindStatusCondition(o.conditions, apimeta.StalledCondition); cond != nil && cond.Status == metav1.ConditionTrue {
+		return cond.Message, true
+	}
+
+	cond := meta.FindStatusCondition(o.conditions, apimeta.ReadyCondition)
+	if cond != nil && cond.Status == metav1.ConditionFalse && cond.Reason == kustomizev1.BuildFailedReason {
+		return cond.Message, true
+	}
+
+	return "", false
+}
+
+func (o treeObject) message() string {
+	cond := meta.FindStatusCondition(o.conditions, apimeta.ReadyCondition)
+	if cond == nil {
+		return "not reconciled yet"
+	}
+
+	return cond.Message
+}
+
+// WaitForAll waits for every Kustomization and HelmRelease created under the root kustomization,
+// the objects are discovered on every poll so the ones created later by nested kustomizations are
+// waited for too. it fails once an object fails, or with the objects which are not ready when the
+// context is done.
+func (c *Client) WaitForAll(ctx context.Context, root types.NamespacedName) error {
+
+	var notReady []treeObject
+	var lastReady, lastTotal int
+
+	err := wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (done bool, err error) {
+		objects, err := c.listTree(ctx, root)
+		if err != nil {
+			return false, err
+		}
+
+		notReady = nil
+		var genErr error
+		for _, obj := range objects {
+			if msg, failed := obj.failed(); failed {
+				genErr = errors.Join(genErr, fmt.Errorf("%s failed: %s", obj, msg))
+				continue
+			}
+
+			if !obj.ready() {
+				notReady = append(notReady, obj)
+			}
+		}
+
+		if genErr != nil {
+			return false, genErr
+		}
+
+		ready := len(objects) - len(notReady)
+		if ready != lastReady || len(objects) != lastTotal {
+			fmt.Fprintf(c.out, "%d/%d flux objects are ready \n", ready, len(objects))
+			lastReady, lastTotal = ready, len(objects)
+		}
+
+		// The root is missing until flux is bootstrapped
+		return len(objects) > 0 && len(notReady) == 0, nil
+	})
+
+	if err != nil && len(notReady) > 0 && errors.Is(err, ctx.Err()) {
+		var msgs []string
+		for _, obj := range notReady {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", obj, obj.message()))
+		}
+
+		return fmt.Errorf("%w, not ready:\n%s", err, strings.Join(msgs, "\n"))
+	}
+
+	return err
+}
+
+// listTree returns the Kustomizations and HelmReleases which were applied by the root, or by
+// kustomizations under it.
+func (c *Client) listTree(ctx context.Context, root types.NamespacedName) ([]treeObject, error) {
+
+	kss, err := c.ListKs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kustomizations: %w", err)
+	}
+
+	var hrs helmv2.HelmReleaseList
+	err = c.kubeClient.List(ctx, &hrs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list helmreleases: %w", err)
+	}
+
+	var objects []treeObject
+	for _, ks := range kss {
+		objects = append(objects, treeObject{
+			kind:               kustomizev1.KustomizationKind,
+			name:               types.NamespacedName{Namespace: ks.Namespace, Name: ks.Name},
+			parent:             parentKs(ks.Labels),
+			generation:         ks.Generation,
+			conditions:         ks.Status.Conditions,
+			observedGeneration: ks.Status.ObservedGeneration,
+		})
+	}
+
+	for _, hr := range hrs.Items {
+		objects = append(objects, treeObject{
+			kind:               helmv2.HelmReleaseKind,
+			name:               types.NamespacedName{Namespace: hr.Namespace, Name: hr.Name},
+			parent:             parentKs(hr.Labels),
+			generation:         hr.Generation,
+			conditions:         hr.Status.Conditions,
+			observedGeneration: hr.Status.ObservedGeneration,
+		})
+	}
+
+	return filterTree(objects, root), nil
+}
+
+// filterTree keeps the objects whose chain of parents reaches the root
+func filterTree(objects []treeObject, root types.NamespacedName) []treeObject {
+	parents := make(map[types.NamespacedName]*types.NamespacedName)
+	for _, obj := range objects {
+		if obj.kind == kustomizev1.KustomizationKind {
+			parents[obj.name] = obj.parent
+		}
+	}
+
+	inTree := func(obj treeObject) bool {
+		if obj.kind == kustomizev1.KustomizationKind && obj.name == root {
+			return true
+		}
+
+		// Limit the depth in case the labels make a loop
+		parent := obj.parent
+		for i := 0; parent != nil && i < len(parents)+1; i++ {
+			if *parent == root {
+				return true
+			}
+			parent = parents[*parent]
+		}
+
+		return false
+	}
+
+	var res []treeObject
+	for _, obj := range objects {
+		if inTree(obj) {
+			res = append(res, obj)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].String() < res[j].String()
+	})
+
+	return res
+}
+
+// parentKs returns the kustomization that applied the object
+func parentKs(labels map[string]string) *types.NamespacedName {
+	name, ok := labels[ksNameLabel]
+	if !ok {
+		return nil
+	}
+
+	return &types.NamespacedName{
+		Namespace: labels[ksNamespaceLabel],
+		Name:      name,
+	}
+}
@@ -0,0 +1,46 @@
+package flux
+
+import (
+	"testing"
+
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta2"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestFilterTree(t *testing.T) {
+	ks := func(namespace, name string, parent *types.NamespacedName) treeObject {
+		return treeObject{
+			kind:   kustomizev1.KustomizationKind,
+			name:   types.NamespacedName{Namespace: namespace, Name: name},
+			parent: parent,
+		}
+	}
+
+	objects := []treeObject{
+		ks("flux-system", "flux-system", &Root),
+		ks("flux-system", "infra", &Root),
+		ks("flux-system", "apps", &types.NamespacedName{Namespace: "flux-system", Name: "infra"}),
+		{
+			kind:   "HelmRelease",
+			name:   types.NamespacedName{Namespace: "apps", Name: "podinfo"},
+			parent: &types.NamespacedName{Namespace: "flux-system", Name: "apps"},
+		},
+
+		// Created by hand and by a kustomization which is not under the root
+		ks("default", "manual", nil),
+		ks("default", "other", &types.NamespacedName{Namespace: "default", Name: "manual"}),
+	}
+
+	var names []string
+	for _, obj := range filterTree(objects, Root) {
+		names = append(names, obj.String())
+	}
+
+	require.Equal(t, []string{
+		"HelmRelease apps/podinfo",
+		"Kustomization flux-system/apps",
+		"Kustomization flux-system/flux-system",
+		"Kustomization flux-system/infra",
+	}, names)
+}
@@ -3,13 +3,9 @@ package gitea
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"io"
 	"io/fs"
@@ -21,14 +17,27 @@ import (
 	"time"
 
 	"code.gitea.io/sdk/gitea"
+	"github.com/ezratameno/integration/pkg/container"
 	"github.com/ezratameno/integration/pkg/exec"
 )
 
+// ErrCreateContainer is returned by Start when the gitea container was not created
+var ErrCreateContainer = container.ErrCreate
+
+// Image is the gitea image the container is created from by default
+const Image = "gitea/gitea:1.21.7"
+
+// dataPath is where gitea keeps the repos, the database and app.ini in the container
+const dataPath = "/data"
+
 type Opts struct {
 	SSHPort  int
 	HttpPort int
 	Addr     string
 
+	// Runtime the gitea container is run with, docker when it's empty
+	Runtime container.Runtime
+
 	adminUser     string
 	adminPassword string
 	adminEmail    string
@@ -38,13 +47,15 @@ type Client struct {
 	opts   Opts
 	do     *http.Client
 	client *gitea.Client
+	runner exec.Runner
 	out    io.Writer
 }
 
-func NewClient(opts Opts, out io.Writer) *Client {
+func NewClient(opts Opts, runner exec.Runner, out io.Writer) *Client {
 	c := &Client{
-		opts: opts,
-		out:  out,
+		opts:   opts,
+		runner: runner,
+		out:    out,
 		do: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -62,33 +73,129 @@ type StartContainerOpts struct {
 	Password      string
 	Username      string
 	ContainerName string
+
+	ContainerOpts
 }
 
-func (c *Client) Start(ctx context.Context, opts StartContainerOpts) (string, error) {
+// ContainerOpts configure the gitea container, the zero value runs Image without limits
+type ContainerOpts struct {
+	// Image the container is created from, defaults to Image
+	Image string
+
+	// Tag replaces the tag of the image, like 1.22.1
+	Tag string
+
+	// Env is set on the container, GITEA__section__KEY overrides KEY of the section in app.ini.
+	// GITEA__security__INSTALL_LOCK is true unless it's overridden, so the install page is skipped
+	Env map[string]string
+
+	// DataVolume is a named volume mounted on /data, it keeps the repos and the database
+	// when the container is removed. it's removed with the environment unless it's kept
+	DataVolume string
 
-	var buf bytes.Buffer
+	// Network the container is attached to
+	Network string
+
+	Labels map[string]string
+
+	// Memory limit in bytes, no limit when it's 0
+	Memory int64
+
+	// CPUs limit, no limit when it's 0
+	CPUs float64
+}
+
+// ImageRef returns the image the container is created from, with the tag of the options
+func (o ContainerOpts) ImageRef() string {
+	image := o.Image
+	if image == "" {
+		image = Image
+	}
+
+	if o.Tag == "" {
+		return image
+	}
+
+	// The tag is after the last colon, unless the colon is of the port of the registry
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	return fmt.Sprintf("%s:%s", image, o.Tag)
+}
+
+// containerSpec returns the spec the gitea container is run with
+func (c *Client) containerSpec(opts StartContainerOpts) container.Spec {
+	env := map[string]string{
+		"GITEA__security__INSTALL_LOCK": "true",
+
+		// The webhooks call the receiver of the cluster on a private ip
+		"GITEA__webhook__ALLOWED_HOST_LIST": "private",
+	}
+
+	for key, value := range opts.Env {
+		env[key] = value
+	}
+
+	spec := container.Spec{
+		Name:  opts.ContainerName,
+		Image: opts.ImageRef(),
+		Ports: []container.Port{
+			{Host: c.opts.HttpPort, Container: 3000},
+			{Host: c.opts.SSHPort, Container: 22},
+		},
+		Env:     env,
+		Labels:  opts.Labels,
+		Network: opts.Network,
+		Memory:  opts.Memory,
+		CPUs:    opts.CPUs,
+	}
+
+	if opts.DataVolume != "" {
+		spec.Volumes = append(spec.Volumes, container.Volume{Name: opts.DataVolume, Path: dataPath})
+	}
+
+	return spec
+}
 
-	// GITEA__security__INSTALL_LOCK=true skip on the installation page
-	cmd := fmt.Sprintf("docker run -d -p %d:3000 -p %d:22 -e GITEA__security__INSTALL_LOCK=true --name %s  gitea/gitea:1.21.7", c.opts.HttpPort, c.opts.SSHPort, opts.ContainerName)
-	err := exec.LocalExecContext(ctx, cmd, &buf)
+func (c *Client) Start(ctx context.Context, opts StartContainerOpts) (string, error) {
+
+	err := c.opts.Runtime.Run(ctx, c.containerSpec(opts))
 	if err != nil {
-		return opts.ContainerName, fmt.Errorf("failed to create container: %s %w", buf.String(), err)
+		return opts.ContainerName, err
 	}
 
 	fmt.Fprintln(c.out, "start gitea container")
 
 	// 2. sign up, the first user that signs up is admin
-
-	// give time for the gitea to start
-
-	// TODO: check for a better way
-	time.Sleep(10 * time.Second)
+	err = c.WaitReady(ctx)
+	if err != nil {
+		return opts.ContainerName, err
+	}
 
 	err = c.Signup(ctx, opts)
 	if err != nil {
 		return opts.ContainerName, fmt.Errorf("failed signing user: %w", err)
 	}
 
+	err = c.Login(opts)
+	if err != nil {
+		return opts.ContainerName, err
+	}
+
+	return opts.ContainerName, nil
+}
+
+// WithRuntime returns a copy of the client which runs the gitea container with the runtime
+func (c *Client) WithRuntime(runtime container.Runtime) *Client {
+	clone := *c
+	clone.opts.Runtime = runtime
+	return &clone
+}
+
+// Login sets up the admin user of an existing gitea, the user must already be signed up.
+func (c *Client) Login(opts StartContainerOpts) error {
+
 	// Set up admin information
 	c.opts.adminEmail = opts.Email
 	c.opts.adminUser = opts.Username
@@ -97,24 +204,112 @@ func (c *Client) Start(ctx context.Context, opts StartContainerOpts) (string, er
 	client, err := gitea.NewClient(fmt.Sprintf("%s:%d", c.opts.Addr, c.opts.HttpPort),
 		gitea.SetBasicAuth(c.opts.adminUser, c.opts.adminPassword))
 	if err != nil {
-		return opts.ContainerName, fmt.Errorf("failed to create gitea client: %w", err)
+		return fmt.Errorf("failed to create gitea client: %w", err)
 	}
 
 	c.client = client
 
-	return opts.ContainerName, nil
+	return nil
+}
+
+// readyTimeout is how long we wait for the gitea api to respond
+const readyTimeout = 2 * time.Minute
+
+// WaitReady waits until the gitea api responds, for up to readyTimeout
+func (c *Client) WaitReady(ctx context.Context) error {
+	url := fmt.Sprintf("%s:%d/api/v1/version", c.opts.Addr, c.opts.HttpPort)
+
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.do.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+
+			err = fmt.Errorf("status code %d", resp.StatusCode)
+		}
+
+		// The error of a request canceled by the deadline says less than the one before it
+		if ctx.Err() == nil || lastErr == nil {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gitea is not ready: %w, last error: %w", ctx.Err(), lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+// StartExisting starts an existing gitea container, it does nothing if the container is running.
+func (c *Client) StartExisting(ctx context.Context, containerName string) error {
+	_, err := c.runner.Run(ctx, c.opts.Runtime.Command("container", "start", containerName))
+	if err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+	return nil
 }
 
 func (c *Client) Delete(ctx context.Context, containerName string) error {
-	var buf bytes.Buffer
-	cmd := fmt.Sprintf("docker container rm -f %s", containerName)
-	err := exec.LocalExecContext(ctx, cmd, &buf)
+	_, err := c.runner.Run(ctx, c.opts.Runtime.Command("container", "rm", "-f", containerName))
 	if err != nil {
-		return fmt.Errorf("failed to delete container: %s %w", buf.String(), err)
+		return fmt.Errorf("failed to delete container: %w", err)
 	}
 	return nil
 }
 
+// VolumeExists checks if a volume with the name already exists
+func (c *Client) VolumeExists(ctx context.Context, name string) (bool, error) {
+	res, err := c.runner.Run(ctx, c.opts.Runtime.Command("volume", "inspect", name))
+	if err != nil {
+		// docker prints "No such volume" and podman "no such volume"
+		if strings.Contains(strings.ToLower(res.Output()), "no such volume") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to inspect volume: %w", err)
+	}
+
+	return true, nil
+}
+
+// DeleteVolume removes the volume, it does nothing if the volume doesn't exist
+func (c *Client) DeleteVolume(ctx context.Context, name string) error {
+	res, err := c.runner.Run(ctx, c.opts.Runtime.Command("volume", "rm", "-f", name))
+	if err != nil && !strings.Contains(strings.ToLower(res.Output()), "no such volume") {
+		return fmt.Errorf("failed to delete volume %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// ContainerExists checks if a container with the name already exists
+func (c *Client) ContainerExists(ctx context.Context, containerName string) (bool, error) {
+	res, err := c.runner.Run(ctx, c.opts.Runtime.Command("container", "inspect", containerName))
+	if err != nil {
+		// docker prints "No such container" and podman "no such container"
+		if strings.Contains(strings.ToLower(res.Output()), "no such container") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	return true, nil
+}
+
 func (c *Client) Signup(ctx context.Context, opts StartContainerOpts) error {
 
 	signUpurl := fmt.Sprintf("%s:%d/user/sign_up", c.opts.Addr, c.opts.HttpPort)
@@ -162,71 +357,55 @@ func (c *Client) Signup(ctx context.Context, opts StartContainerOpts) error {
 	return nil
 }
 
-// GeneratePrivatePublicKeys will generate a public and private key in gitea.
-// the user will pass the path to where to save the private key.
-func (c *Client) GeneratePrivatePublicKeys(publicKeyName string, privateKeyPath string) (*gitea.PublicKey, error) {
+// CreateRepoFromExisting creates a repo and copies all the files from the location
+func (c *Client) CreateRepoFromExisting(ctx context.Context, opts gitea.CreateRepoOption, filesLocation string) (*gitea.Repository, error) {
 
-	privateKey, err := rsa.GenerateKey(rand.Reader, 3071)
+	repo, _, err := c.client.CreateRepo(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate private key: %w", err)
+		return nil, err
 	}
 
-	// Extract the public key from the private key
-	publicKey := privateKey.Public()
-
-	// Convert the public key
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	files, err := readLocalFiles(filesLocation)
 	if err != nil {
 		return nil, err
 	}
 
-	// Encode the public key to Pem format
-	publicKeyPem := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: publicKeyBytes,
-	})
+	var createOpts CreateMultiFiles
 
-	// Create public key in gitea
-	pubKey, _, err := c.client.CreatePublicKey(gitea.CreateKeyOption{
-		Title: publicKeyName,
-		Key:   string(publicKeyPem),
-	})
+	for _, fileLoc := range sortedKeys(files) {
+		createOpts.Files = append(createOpts.Files, File{
+			Content:   base64.StdEncoding.EncodeToString(files[fileLoc]),
+			Operation: operationCreate,
+			Path:      fileLoc,
+		})
+	}
 
+	fmt.Fprintln(c.out, "uploading local files to gitea")
+	err = c.CreateMultiFiles(ctx, createOpts, c.opts.adminUser, repo.Name)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: do i need to supply a function that delete the key in case of failure?
-
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
-
-	// Encode the public key to PEM format
-	privateKeyPem := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: privateKeyBytes,
-	})
+	return repo, nil
+}
 
-	// Save the private key to file
-	err = os.WriteFile(privateKeyPath, privateKeyPem, 0744)
+// LocalFiles returns the files of the local repo which are uploaded to gitea
+func LocalFiles(repoPath string) ([]string, error) {
+	files, err := readLocalFiles(repoPath)
 	if err != nil {
-		return pubKey, fmt.Errorf("failed to save private key to file: %w", err)
+		return nil, err
 	}
 
-	return pubKey, nil
+	return sortedKeys(files), nil
 }
 
-// CreateRepoFromExisting creates a repo and copies all the files from the location
-func (c *Client) CreateRepoFromExisting(ctx context.Context, opts gitea.CreateRepoOption, filesLocation string) (*gitea.Repository, error) {
-
-	repo, _, err := c.client.CreateRepo(opts)
-	if err != nil {
-		return nil, err
-	}
+// readLocalFiles reads all the files from the location that should be uploaded to gitea,
+// the files are keyed by their path relative to the location.
+func readLocalFiles(filesLocation string) (map[string][]byte, error) {
 
-	var createOpts CreateMultiFiles
+	files := make(map[string][]byte)
 
-	// Copy all the files from the location to the gitea repo
-	err = filepath.WalkDir(filesLocation, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(filesLocation, func(path string, d fs.DirEntry, err error) error {
 
 		if err != nil {
 			return err
@@ -245,8 +424,6 @@ func (c *Client) CreateRepoFromExisting(ctx context.Context, opts gitea.CreateRe
 			return nil
 		}
 
-		// fmt.Println("path", path)
-
 		fileLoc := strings.TrimPrefix(path, filesLocation+"/")
 
 		body, err := os.ReadFile(path)
@@ -254,17 +431,12 @@ func (c *Client) CreateRepoFromExisting(ctx context.Context, opts gitea.CreateRe
 
 			// We do this for links
 			if strings.Contains(err.Error(), "is a directory") {
-				// fmt.Println(path)
 				return nil
 			}
 			return err
 		}
 
-		createOpts.Files = append(createOpts.Files, File{
-			Content:   base64.StdEncoding.EncodeToString(body),
-			Operation: operationCreate,
-			Path:      fileLoc,
-		})
+		files[fileLoc] = body
 
 		return nil
 	})
@@ -273,13 +445,7 @@ func (c *Client) CreateRepoFromExisting(ctx context.Context, opts gitea.CreateRe
 		return nil, err
 	}
 
-	fmt.Fprintln(c.out, "uploading local files to gitea")
-	err = c.CreateMultiFiles(ctx, createOpts, c.opts.adminUser, repo.Name)
-	if err != nil {
-		return nil, err
-	}
-
-	return nil, nil
+	return files, nil
 }
 
 type CreateMultiFiles struct {
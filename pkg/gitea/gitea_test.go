@@ -0,0 +1,166 @@
+package gitea
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestContainerExists(t *testing.T) {
+
+	runner := exec.NewFakeRunner().
+		OnExit("docker container inspect missing", 1, "Error: No such container: missing").
+		OnExit("docker container inspect broken", 1, "Cannot connect to the Docker daemon")
+
+	c := NewClient(Opts{}, runner, io.Discard)
+
+	exists, err := c.ContainerExists(context.Background(), "gitea")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = c.ContainerExists(context.Background(), "missing")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = c.ContainerExists(context.Background(), "broken")
+	require.ErrorContains(t, err, "Cannot connect to the Docker daemon")
+
+	runner = exec.NewFakeRunner().
+		OnExit("podman container inspect missing", 125, "Error: no such container missing")
+
+	c = NewClient(Opts{Runtime: container.Podman}, runner, io.Discard)
+
+	exists, err = c.ContainerExists(context.Background(), "missing")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestVolume(t *testing.T) {
+
+	runner := exec.NewFakeRunner().
+		OnExit("podman volume inspect missing", 125, "Error: no such volume missing").
+		OnExit("podman volume rm -f missing", 1, "Error: no such volume missing")
+
+	c := NewClient(Opts{Runtime: container.Podman}, runner, io.Discard)
+
+	exists, err := c.VolumeExists(context.Background(), "gitea-data")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = c.VolumeExists(context.Background(), "missing")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, c.DeleteVolume(context.Background(), "gitea-data"))
+	require.NoError(t, c.DeleteVolume(context.Background(), "missing"))
+	require.Contains(t, runner.Commands(), "podman volume rm -f gitea-data")
+}
+
+func TestConnectNetwork(t *testing.T) {
+
+	runner := exec.NewFakeRunner().
+		On("docker container inspect --format {{json .NetworkSettings.Networks}} gitea", exec.Result{Stdout: []byte(`{"bridge":{}}`)}, nil).
+		On("docker container inspect --format {{json .NetworkSettings.Networks}} connected", exec.Result{Stdout: []byte(`{"bridge":{},"kind":{}}`)}, nil)
+
+	c := NewClient(Opts{Runtime: container.Docker}, runner, io.Discard)
+
+	require.NoError(t, c.ConnectNetwork(context.Background(), "gitea", "kind"))
+	require.NoError(t, c.ConnectNetwork(context.Background(), "connected", "kind"))
+
+	commands := runner.Commands()
+	require.Contains(t, commands, "docker network connect kind gitea")
+	require.NotContains(t, commands, "docker network connect kind connected")
+}
+
+func TestDisconnectNetwork(t *testing.T) {
+
+	runner := exec.NewFakeRunner().
+		On("docker container inspect --format {{json .NetworkSettings.Networks}} gitea", exec.Result{Stdout: []byte(`{"bridge":{}}`)}, nil).
+		On("docker container inspect --format {{json .NetworkSettings.Networks}} connected", exec.Result{Stdout: []byte(`{"bridge":{},"kind":{}}`)}, nil).
+		OnExit("docker container inspect missing", 1, "Error: No such container: missing")
+
+	c := NewClient(Opts{Runtime: container.Docker}, runner, io.Discard)
+
+	require.NoError(t, c.DisconnectNetwork(context.Background(), "gitea", "kind"))
+	require.NoError(t, c.DisconnectNetwork(context.Background(), "connected", "kind"))
+	require.NoError(t, c.DisconnectNetwork(context.Background(), "missing", "kind"))
+
+	commands := runner.Commands()
+	require.Contains(t, commands, "docker network disconnect kind connected")
+	require.NotContains(t, commands, "docker network disconnect kind gitea")
+	require.NotContains(t, commands, "docker network disconnect kind missing")
+}
+
+func TestContainerSpec(t *testing.T) {
+
+	tests := []struct {
+		opts     ContainerOpts
+		expected string
+	}{
+		{opts: ContainerOpts{}, expected: Image},
+		{opts: ContainerOpts{Tag: "1.22.1"}, expected: "gitea/gitea:1.22.1"},
+		{opts: ContainerOpts{Image: "localhost:5000/gitea", Tag: "dev"}, expected: "localhost:5000/gitea:dev"},
+		{opts: ContainerOpts{Image: "localhost:5000/gitea:1.21.7"}, expected: "localhost:5000/gitea:1.21.7"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, test.opts.ImageRef())
+	}
+
+	c := NewClient(Opts{HttpPort: 3000, SSHPort: 2222}, exec.NewFakeRunner(), io.Discard)
+
+	spec := c.containerSpec(StartContainerOpts{
+		ContainerName: "gitea",
+		ContainerOpts: ContainerOpts{
+			Env:        map[string]string{"GITEA__server__ROOT_URL": "http://localhost:3000"},
+			DataVolume: "gitea-data",
+		},
+	})
+
+	require.Equal(t, map[string]string{
+		"GITEA__security__INSTALL_LOCK":     "true",
+		"GITEA__webhook__ALLOWED_HOST_LIST": "private",
+		"GITEA__server__ROOT_URL":           "http://localhost:3000",
+	}, spec.Env)
+	require.Equal(t, "gitea-data", spec.Volumes[0].Name)
+	require.Equal(t, "/data", spec.Volumes[0].Path)
+}
+
+func TestGenerateKey(t *testing.T) {
+
+	for _, algorithm := range []KeyAlgorithm{KeyEd25519, KeyECDSA, KeyRSA} {
+		privateKey, authorizedKey, err := GenerateKey(algorithm, "deploy")
+		require.NoError(t, err)
+
+		signer, err := ssh.ParsePrivateKey(privateKey)
+		require.NoError(t, err)
+
+		publicKey, comment, _, _, err := ssh.ParseAuthorizedKey(authorizedKey)
+		require.NoError(t, err)
+		require.Equal(t, signer.PublicKey().Marshal(), publicKey.Marshal())
+		require.Equal(t, "deploy", comment)
+	}
+
+	_, err := ParseKeyAlgorithm("dsa")
+	require.Error(t, err)
+}
+
+func TestGitBlobSha(t *testing.T) {
+	tests := []struct {
+		content string
+		sha     string
+	}{
+		{content: "", sha: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"},
+		{content: "hello\n", sha: "ce013625030ba8dba906f756967f9e9ca394464a"},
+		{content: "hello world", sha: "95d09f2b10159347eece71399a7e2e907ea3df4f"},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.sha, gitBlobSha([]byte(tt.content)), "content %q", tt.content)
+	}
+}
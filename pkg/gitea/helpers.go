@@ -2,7 +2,10 @@ package gitea
 
 import (
 	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"sort"
 )
 
 func randomString(length int) string {
@@ -10,3 +13,20 @@ func randomString(length int) string {
 	rand.Read(b)
 	return fmt.Sprintf("%x", b)[2 : length+2]
 }
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// gitBlobSha returns the sha git uses for a file with the content
+func gitBlobSha(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,139 @@
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"code.gitea.io/sdk/gitea"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyAlgorithm is the algorithm of the ssh keys
+type KeyAlgorithm string
+
+const (
+	KeyEd25519 KeyAlgorithm = "ed25519"
+
+	// KeyECDSA is a P-256 key
+	KeyECDSA KeyAlgorithm = "ecdsa"
+
+	// KeyRSA is a 4096 bits key
+	KeyRSA KeyAlgorithm = "rsa"
+)
+
+// ParseKeyAlgorithm returns the algorithm of the name, ed25519 when the name is empty
+func ParseKeyAlgorithm(name string) (KeyAlgorithm, error) {
+	switch KeyAlgorithm(name) {
+	case "":
+		return KeyEd25519, nil
+	case KeyEd25519, KeyECDSA, KeyRSA:
+		return KeyAlgorithm(name), nil
+	}
+
+	return "", fmt.Errorf("unknown key algorithm %q, use ed25519, ecdsa or rsa", name)
+}
+
+// GenerateKey returns a private key in the OpenSSH format and its public key in the authorized keys format
+func GenerateKey(algorithm KeyAlgorithm, comment string) ([]byte, []byte, error) {
+
+	var privateKey crypto.Signer
+	var err error
+
+	switch algorithm {
+	case KeyEd25519, "":
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	case KeyECDSA:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyRSA:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return nil, nil, fmt.Errorf("unknown key algorithm %q", algorithm)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate %s key: %w", algorithm, err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, comment)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	authorizedKey := bytes.TrimSuffix(ssh.MarshalAuthorizedKey(publicKey), []byte("\n"))
+	if comment != "" {
+		authorizedKey = append(authorizedKey, " "+comment...)
+	}
+
+	return pem.EncodeToMemory(block), append(authorizedKey, '\n'), nil
+}
+
+type DeployKeyOpts struct {
+	Repo  string
+	Title string
+
+	// Algorithm of the key, defaults to ed25519
+	Algorithm KeyAlgorithm
+
+	// ReadOnly keys can only clone the repo
+	ReadOnly bool
+
+	// PrivateKeyPath where to save the private key, only the user can read it
+	PrivateKeyPath string
+}
+
+// CreateDeployKey generates a key and adds it as a deploy key of the repo of the admin user,
+// the private key is saved to the private key path.
+// the deploy key is returned also when saving the private key failed, so it can be deleted.
+func (c *Client) CreateDeployKey(ctx context.Context, opts DeployKeyOpts) (*gitea.DeployKey, error) {
+
+	privateKey, authorizedKey, err := GenerateKey(opts.Algorithm, opts.Title)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, err := c.client.CreateDeployKey(c.opts.adminUser, opts.Repo, gitea.CreateKeyOption{
+		Title:    opts.Title,
+		Key:      string(authorizedKey),
+		ReadOnly: opts.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deploy key of repo %s: %w", opts.Repo, err)
+	}
+
+	err = os.WriteFile(opts.PrivateKeyPath, privateKey, 0600)
+	if err != nil {
+		return key, fmt.Errorf("failed to save private key to file: %w", err)
+	}
+
+	// WriteFile keeps the mode of an existing file
+	err = os.Chmod(opts.PrivateKeyPath, 0600)
+	if err != nil {
+		return key, fmt.Errorf("failed to set the mode of the private key file: %w", err)
+	}
+
+	return key, nil
+}
+
+// DeleteDeployKey deletes the deploy key from the repo of the admin user
+func (c *Client) DeleteDeployKey(repo string, id int64) error {
+	_, err := c.client.DeleteDeployKey(c.opts.adminUser, repo, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete deploy key of repo %s: %w", repo, err)
+	}
+
+	return nil
+}
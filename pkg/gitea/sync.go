@@ -0,0 +1,135 @@
+package gitea
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+// SyncRepoFromExisting makes the repo content the same as the files in the location.
+// the repo is created if it doesn't exist, otherwise only the changed files are committed.
+func (c *Client) SyncRepoFromExisting(ctx context.Context, opts gitea.CreateRepoOption, filesLocation string) (*gitea.Repository, error) {
+
+	repo, resp, err := c.client.GetRepo(c.opts.adminUser, opts.Name)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return c.CreateRepoFromExisting(ctx, opts, filesLocation)
+		}
+		return nil, fmt.Errorf("failed to get repo %s: %w", opts.Name, err)
+	}
+
+	files, err := readLocalFiles(filesLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := c.listFiles(ctx, c.opts.adminUser, repo.Name, repo.DefaultBranch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of repo %s: %w", repo.Name, err)
+	}
+
+	var syncOpts CreateMultiFiles
+	syncOpts.Message = "sync local files"
+
+	for _, fileLoc := range sortedKeys(files) {
+		content := files[fileLoc]
+		sha, ok := entries[fileLoc]
+
+		switch {
+		case !ok:
+			syncOpts.Files = append(syncOpts.Files, File{
+				Content:   base64.StdEncoding.EncodeToString(content),
+				Operation: operationCreate,
+				Path:      fileLoc,
+			})
+
+		case sha != gitBlobSha(content):
+			syncOpts.Files = append(syncOpts.Files, File{
+				Content:   base64.StdEncoding.EncodeToString(content),
+				Operation: operationUpdate,
+				Path:      fileLoc,
+				Sha:       sha,
+			})
+		}
+	}
+
+	// Delete the files that were removed locally
+	for _, fileLoc := range sortedKeys(entries) {
+		if _, ok := files[fileLoc]; ok {
+			continue
+		}
+
+		syncOpts.Files = append(syncOpts.Files, File{
+			Operation: operationDelete,
+			Path:      fileLoc,
+			Sha:       entries[fileLoc],
+		})
+	}
+
+	if len(syncOpts.Files) == 0 {
+		fmt.Fprintf(c.out, "repo %s is up to date \n", repo.Name)
+		return repo, nil
+	}
+
+	fmt.Fprintf(c.out, "syncing %d changed files to repo %s \n", len(syncOpts.Files), repo.Name)
+	err = c.CreateMultiFiles(ctx, syncOpts, c.opts.adminUser, repo.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// listFiles returns the sha of every file in the repo keyed by the file path
+func (c *Client) listFiles(ctx context.Context, owner, repo, ref string) (map[string]string, error) {
+
+	files := make(map[string]string)
+
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s:%d/api/v1/repos/%s/%s/git/trees/%s?recursive=true&page=%d&per_page=1000",
+			c.opts.Addr, c.opts.HttpPort, owner, repo, ref, page)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.SetBasicAuth(c.opts.adminUser, c.opts.adminPassword)
+		resp, err := c.do.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("status code %d: %s", resp.StatusCode, string(body))
+		}
+
+		var tree gitea.GitTreeResponse
+		err = json.Unmarshal(body, &tree)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range tree.Entries {
+			if entry.Type != "blob" {
+				continue
+			}
+			files[entry.Path] = entry.SHA
+		}
+
+		if !tree.Truncated || len(tree.Entries) == 0 {
+			return files, nil
+		}
+	}
+}
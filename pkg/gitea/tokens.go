@@ -0,0 +1,54 @@
+package gitea
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+// readRepositoryScope lets the token only clone the repos, the sdk knows only the scopes
+// of the gitea versions before 1.19
+const readRepositoryScope gitea.AccessTokenScope = "read:repository"
+
+// CreateAccessToken creates an access token of the admin user which can only read the repos,
+// the token is how clients which can't use a deploy key clone the private repos.
+func (c *Client) CreateAccessToken(name string) (*gitea.AccessToken, error) {
+	token, _, err := c.client.CreateAccessToken(gitea.CreateAccessTokenOption{
+		Name:   name,
+		Scopes: []gitea.AccessTokenScope{readRepositoryScope},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token %s: %w", name, err)
+	}
+
+	return token, nil
+}
+
+// DeleteAccessToken deletes the access token of the admin user by its id
+func (c *Client) DeleteAccessToken(id int64) error {
+	_, err := c.client.DeleteAccessToken(id)
+	if err != nil {
+		return fmt.Errorf("failed to delete access token %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// DeleteAccessTokens deletes the access tokens of the admin user whose name starts with the prefix
+func (c *Client) DeleteAccessTokens(prefix string) error {
+	tokens, _, err := c.client.ListAccessTokens(gitea.ListAccessTokensOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list access tokens: %w", err)
+	}
+
+	var genErr error
+	for _, token := range tokens {
+		if strings.HasPrefix(token.Name, prefix) {
+			genErr = errors.Join(genErr, c.DeleteAccessToken(token.ID))
+		}
+	}
+
+	return genErr
+}
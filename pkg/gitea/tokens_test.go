@@ -0,0 +1,76 @@
+package gitea
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteAccessTokens(t *testing.T) {
+
+	var deleted []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":"1.22.1"}`))
+	})
+	mux.HandleFunc("GET /api/v1/users/admin/tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id":1,"name":"integration-flux-1700000000"},{"id":2,"name":"other-flux-1700000000"},{"id":3,"name":"integration-flux-1700000001"}]`))
+	})
+	mux.HandleFunc("DELETE /api/v1/users/admin/tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	c := NewClient(Opts{Addr: "http://" + u.Hostname(), HttpPort: port}, exec.NewFakeRunner(), io.Discard)
+	require.NoError(t, c.Login(StartContainerOpts{Username: "admin", Password: "admin"}))
+
+	require.NoError(t, c.DeleteAccessTokens("integration-flux-"))
+	require.Equal(t, []string{"1", "3"}, deleted)
+}
+
+func TestWaitReady(t *testing.T) {
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 2 || r.URL.Path != "/api/v1/version" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"version":"1.22.1"}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	c := NewClient(Opts{Addr: "http://" + u.Hostname(), HttpPort: port}, exec.NewFakeRunner(), io.Discard)
+	require.NoError(t, c.WaitReady(context.Background()))
+	require.Equal(t, 2, calls)
+
+	calls = -10
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	err = c.WaitReady(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "status code 503")
+}
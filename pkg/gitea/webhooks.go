@@ -0,0 +1,101 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+// CreatePushWebhook adds a webhook which calls the url on every push to the repo of the admin user,
+// it does nothing if the repo already has a webhook of the url.
+func (c *Client) CreatePushWebhook(repo, url string) error {
+	hooks, _, err := c.client.ListRepoHooks(c.opts.adminUser, repo, gitea.ListHooksOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks of repo %s: %w", repo, err)
+	}
+
+	for _, hook := range hooks {
+		if hook.Config["url"] == url {
+			return nil
+		}
+	}
+
+	_, _, err = c.client.CreateRepoHook(c.opts.adminUser, repo, gitea.CreateHookOption{
+		Type: gitea.HookTypeGitea,
+		Config: map[string]string{
+			"url":          url,
+			"content_type": "json",
+		},
+		Events:       []string{"push"},
+		BranchFilter: "*",
+		Active:       true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook of repo %s: %w", repo, err)
+	}
+
+	return nil
+}
+
+// ConnectNetwork connects the container to the network, so gitea can call the webhooks of the
+// containers in it. it does nothing if the container is already connected.
+func (c *Client) ConnectNetwork(ctx context.Context, containerName, network string) error {
+	networks, err := c.networks(ctx, containerName)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := networks[network]; ok {
+		return nil
+	}
+
+	_, err = c.runner.Run(ctx, c.opts.Runtime.Command("network", "connect", network, containerName))
+	if err != nil {
+		return fmt.Errorf("failed to connect container %s to network %s: %w", containerName, network, err)
+	}
+
+	return nil
+}
+
+// DisconnectNetwork disconnects the container from the network, so the network can be removed with
+// the cluster. it does nothing if the container doesn't exist or isn't connected.
+func (c *Client) DisconnectNetwork(ctx context.Context, containerName, network string) error {
+	exists, err := c.ContainerExists(ctx, containerName)
+	if err != nil || !exists {
+		return err
+	}
+
+	networks, err := c.networks(ctx, containerName)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := networks[network]; !ok {
+		return nil
+	}
+
+	_, err = c.runner.Run(ctx, c.opts.Runtime.Command("network", "disconnect", network, containerName))
+	if err != nil {
+		return fmt.Errorf("failed to disconnect container %s from network %s: %w", containerName, network, err)
+	}
+
+	return nil
+}
+
+// networks returns the networks the container is connected to by their names
+func (c *Client) networks(ctx context.Context, containerName string) (map[string]json.RawMessage, error) {
+	res, err := c.runner.Run(ctx, c.opts.Runtime.Command("container", "inspect", "--format", "{{json .NetworkSettings.Networks}}", containerName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	var networks map[string]json.RawMessage
+	err = json.Unmarshal(res.Stdout, &networks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode networks of container %s: %w", containerName, err)
+	}
+
+	return networks, nil
+}
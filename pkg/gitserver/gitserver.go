@@ -0,0 +1,330 @@
+package gitserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/ezratameno/integration/pkg/gitea"
+)
+
+// Branch is the branch the local files are committed to
+const Branch = "main"
+
+type Opts struct {
+	// Dir of the bare repos
+	Dir string
+
+	// Port to listen on, on all the interfaces so the cluster can reach it. 0 picks a free port
+	Port int
+
+	// Username and Password of the basic auth, every request has to use them
+	Username string
+	Password string
+}
+
+// Server is a git server of bare repos in a dir, it serves them over the smart http protocol with
+// git http-backend. it's much lighter than gitea, but the repos can be cloned only while the process
+// that serves them runs.
+type Server struct {
+	opts   Opts
+	runner exec.Runner
+	out    io.Writer
+
+	mu   sync.Mutex
+	srv  *http.Server
+	addr net.Addr
+}
+
+func New(opts Opts, runner exec.Runner, out io.Writer) *Server {
+	return &Server{
+		opts:   opts,
+		runner: runner,
+		out:    out,
+	}
+}
+
+// Start serves the repos until the context is done or Stop is called
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.srv != nil {
+		return nil
+	}
+
+	err := os.MkdirAll(s.opts.Dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create repos dir: %w", err)
+	}
+
+	handler, err := s.Handler()
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.opts.Port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d: %w", s.opts.Port, err)
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := srv.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(s.out, "git server stopped: %s \n", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		s.Stop()
+	}()
+
+	s.srv = srv
+	s.addr = l.Addr()
+
+	fmt.Fprintf(s.out, "serving git repos of %s on port %d \n", s.opts.Dir, s.Port())
+
+	return nil
+}
+
+// Stop stops serving the repos, the repos are kept
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.srv == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := s.srv.Shutdown(ctx)
+	s.srv = nil
+
+	return err
+}
+
+// Serving checks if the repos are already served on the port, like by the create command which keeps
+// serving them. it fails if the port is served with other credentials.
+func (s *Server) Serving(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", s.Port()), nil)
+	if err != nil {
+		return false, err
+	}
+	req.SetBasicAuth(s.opts.Username, s.opts.Password)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Nothing listens on the port
+		return false, nil
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return false, fmt.Errorf("port %d is served with other credentials", s.Port())
+	}
+
+	return true, nil
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	if tcpAddr, ok := s.addr.(*net.TCPAddr); ok {
+		return tcpAddr.Port
+	}
+
+	return s.opts.Port
+}
+
+// Handler returns the handler of the smart http protocol, behind basic auth
+func (s *Server) Handler() (http.Handler, error) {
+	git, err := osexec.LookPath("git")
+	if err != nil {
+		return nil, fmt.Errorf("git binary not found: %w", err)
+	}
+
+	backend := &cgi.Handler{
+		Path: git,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + s.opts.Dir,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || !equal(username, s.opts.Username) || !equal(password, s.opts.Password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		backend.ServeHTTP(w, r)
+	}), nil
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// RepoPath returns the path of the bare repo
+func (s *Server) RepoPath(name string) string {
+	return filepath.Join(s.opts.Dir, name+".git")
+}
+
+// CreateRepo creates a bare repo and commits the files of the local repo to it
+func (s *Server) CreateRepo(ctx context.Context, name string, localPath string) error {
+	repoPath := s.RepoPath(name)
+
+	_, err := s.runner.Run(ctx, exec.Command("git", "init", "--bare", "--quiet", repoPath))
+	if err != nil {
+		return fmt.Errorf("failed to create repo %s: %w", name, err)
+	}
+
+	// flux bootstrap pushes to the repo over http
+	for _, args := range [][]string{
+		{"symbolic-ref", "HEAD", "refs/heads/" + Branch},
+		{"config", "http.receivepack", "true"},
+	} {
+		_, err = s.git(ctx, repoPath, "", nil, nil, args...)
+		if err != nil {
+			return fmt.Errorf("failed to configure repo %s: %w", name, err)
+		}
+	}
+
+	return s.Push(ctx, name, localPath)
+}
+
+// Push commits the files of the local repo to the branch of the repo, the same files gitea gets.
+// nothing is committed when the files didn't change.
+func (s *Server) Push(ctx context.Context, name string, localPath string) error {
+	repoPath := s.RepoPath(name)
+
+	files, err := gitea.LocalFiles(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to read local repo %s: %w", localPath, err)
+	}
+
+	index, err := os.CreateTemp("", "gitserver-index-")
+	if err != nil {
+		return err
+	}
+	index.Close()
+	os.Remove(index.Name())
+	defer os.Remove(index.Name())
+
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+
+	if len(files) > 0 {
+		_, err = s.git(ctx, repoPath, localPath, env, strings.NewReader(strings.Join(files, "\n")+"\n"),
+			"update-index", "--add", "--stdin")
+		if err != nil {
+			return fmt.Errorf("failed to add the files of %s: %w", localPath, err)
+		}
+	}
+
+	res, err := s.git(ctx, repoPath, localPath, env, nil, "write-tree")
+	if err != nil {
+		return fmt.Errorf("failed to write tree: %w", err)
+	}
+	tree := strings.TrimSpace(string(res.Stdout))
+
+	args := []string{"commit-tree", tree, "-m", fmt.Sprintf("sync %s", filepath.Base(localPath))}
+
+	// The branch doesn't exist before the first commit
+	res, err = s.git(ctx, repoPath, "", nil, nil, "rev-parse", "--verify", "--quiet", Branch+"^{commit}")
+	if err == nil {
+		parent := strings.TrimSpace(string(res.Stdout))
+
+		res, err = s.git(ctx, repoPath, "", nil, nil, "rev-parse", parent+"^{tree}")
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(string(res.Stdout)) == tree {
+			return nil
+		}
+
+		args = append(args, "-p", parent)
+	}
+
+	res, err = s.git(ctx, repoPath, "", authorEnv(), nil, args...)
+	if err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+
+	_, err = s.git(ctx, repoPath, "", nil, nil, "update-ref", "refs/heads/"+Branch, strings.TrimSpace(string(res.Stdout)))
+	if err != nil {
+		return fmt.Errorf("failed to update branch %s: %w", Branch, err)
+	}
+
+	fmt.Fprintf(s.out, "pushed %s to repo %s \n", localPath, name)
+
+	return nil
+}
+
+// git runs a git command on the bare repo, with the work tree when it's set
+func (s *Server) git(ctx context.Context, repoPath string, workTree string, env []string, stdin io.Reader, args ...string) (exec.Result, error) {
+	gitArgs := []string{"--git-dir", repoPath}
+	if workTree != "" {
+		gitArgs = append(gitArgs, "--work-tree", workTree)
+	}
+
+	cmd := exec.Command("git", append(gitArgs, args...)...)
+	cmd.Dir = workTree
+	cmd.Env = env
+	cmd.Stdin = stdin
+
+	return s.runner.Run(ctx, cmd)
+}
+
+func authorEnv() []string {
+	return []string{
+		"GIT_AUTHOR_NAME=integration",
+		"GIT_AUTHOR_EMAIL=integration@localhost",
+		"GIT_COMMITTER_NAME=integration",
+		"GIT_COMMITTER_EMAIL=integration@localhost",
+	}
+}
+
+// Exists checks if the repos dir exists
+func (s *Server) Exists() (bool, error) {
+	_, err := os.Stat(s.opts.Dir)
+	if err == nil {
+		return true, nil
+	}
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// Delete stops serving and removes the repos
+func (s *Server) Delete() error {
+	return errors.Join(s.Stop(), os.RemoveAll(s.opts.Dir))
+}
@@ -0,0 +1,76 @@
+package gitserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	local := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(local, "apps"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(local, "apps", "app.yaml"), []byte("kind: ConfigMap\n"), 0644))
+
+	runner := exec.NewLocalRunner()
+	s := New(Opts{
+		Dir:      t.TempDir(),
+		Username: "user",
+		Password: "secret",
+	}, runner, io.Discard)
+
+	require.NoError(t, s.CreateRepo(ctx, "fleet", local))
+	require.NoError(t, s.Start(ctx))
+	defer s.Stop()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/fleet.git", s.Port())
+
+	resp, err := http.Get(url + "/info/refs?service=git-upload-pack")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	clone := filepath.Join(t.TempDir(), "fleet")
+	authURL := strings.Replace(url, "http://", "http://user:secret@", 1)
+	_, err = runner.Run(ctx, exec.Command("git", "clone", "--quiet", "--branch", Branch, authURL, clone))
+	require.NoError(t, err)
+
+	body, err := os.ReadFile(filepath.Join(clone, "apps", "app.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "kind: ConfigMap\n", string(body))
+
+	// Only a change of the files makes a new commit
+	require.NoError(t, s.Push(ctx, "fleet", local))
+	require.NoError(t, os.WriteFile(filepath.Join(local, "apps", "app.yaml"), []byte("kind: Secret\n"), 0644))
+	require.NoError(t, s.Push(ctx, "fleet", local))
+
+	res, err := runner.Run(ctx, exec.Command("git", "--git-dir", s.RepoPath("fleet"), "rev-list", "--count", Branch))
+	require.NoError(t, err)
+	require.Equal(t, "2", strings.TrimSpace(string(res.Stdout)))
+
+	// Another process attaching to the repos finds them served
+	other := New(Opts{Dir: s.opts.Dir, Port: s.Port(), Username: "user", Password: "secret"}, runner, io.Discard)
+	serving, err := other.Serving(ctx)
+	require.NoError(t, err)
+	require.True(t, serving)
+
+	other.opts.Password = "wrong"
+	_, err = other.Serving(ctx)
+	require.ErrorContains(t, err, "other credentials")
+
+	require.NoError(t, s.Stop())
+	other.opts.Password = "secret"
+	serving, err = other.Serving(ctx)
+	require.NoError(t, err)
+	require.False(t, serving)
+}
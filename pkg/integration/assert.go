@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ezratameno/integration/pkg/assert"
+	"github.com/ezratameno/integration/pkg/report"
+)
+
+// Assert waits for the objects of the assertion files to be in the cluster of the environment
+func (c *Client) Assert(ctx context.Context, opts assert.Opts, paths ...string) error {
+	if c.env == nil {
+		return fmt.Errorf("no environment, create or attach to one first")
+	}
+
+	provider, err := c.clusterProvider(c.env.ClusterProvider, c.env.KubeContext)
+	if err != nil {
+		return err
+	}
+
+	assertClient, err := assert.NewClient(provider.KubeContext(c.env.KindClusterName), c.out)
+	if err != nil {
+		return fmt.Errorf("failed to create assert client: %w", err)
+	}
+
+	assertions, err := assert.Load(paths...)
+	if err != nil {
+		return err
+	}
+
+	var genErr error
+	for _, res := range assertClient.Check(ctx, opts, assertions...) {
+		err := c.redactor.Error(res.Err)
+
+		c.report.Add(report.Case{
+			Suite:     "assert",
+			Name:      res.Assertion.String(),
+			StartedAt: res.StartedAt,
+			Duration:  res.Duration,
+			Failure:   errString(err),
+		})
+
+		genErr = errors.Join(genErr, err)
+	}
+
+	if genErr != nil {
+		return fmt.Errorf("assertions failed: %w", genErr)
+	}
+
+	return nil
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
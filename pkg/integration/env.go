@@ -0,0 +1,356 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/cluster"
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/ezratameno/integration/pkg/gitea"
+)
+
+// Env is the state of a created environment. It's saved when the environment is created
+// so it can be attached later, the environment is named after its cluster.
+type Env struct {
+	Name string `json:"name"`
+
+	// ClusterProvider created the cluster, empty for the environments saved before there
+	// were other providers than kind
+	ClusterProvider string `json:"clusterProvider,omitempty"`
+	KubeContext     string `json:"kubeContext,omitempty"`
+
+	// GitServer hosts the repos, gitea or local. empty for gitea
+	GitServer string `json:"gitServer,omitempty"`
+
+	// ContainerRuntime runs the gitea container and the cluster nodes, empty for docker
+	ContainerRuntime   container.Runtime `json:"containerRuntime,omitempty"`
+	KindClusterName    string            `json:"kindClusterName"`
+	GiteaContainerName string            `json:"giteaContainerName"`
+	GiteaHttpPort      int               `json:"giteaHttpPort"`
+	GiteaSshPort       int               `json:"giteaSshPort"`
+	GiteaUsername      string            `json:"giteaUsername"`
+	GiteaPassword      string            `json:"giteaPassword"`
+	PrivateKeyPath     string            `json:"privateKeyPath"`
+
+	// GiteaToken is the access token the cluster clones the repos with
+	GiteaToken string `json:"giteaToken,omitempty"`
+
+	// PrivateRepos are only cloned with credentials
+	PrivateRepos bool `json:"privateRepos,omitempty"`
+
+	// GiteaDataVolume keeps the gitea data, it's removed with the environment
+	GiteaDataVolume string `json:"giteaDataVolume,omitempty"`
+
+	FluxBootstrapRepo   string   `json:"fluxBootstrapRepo"`
+	FluxPath            string   `json:"fluxPath"`
+	GiteaLocalRepoPaths []string `json:"giteaLocalRepoPaths"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// runtime returns the runtime the containers of the environment run with, the environments
+// saved before podman was supported run with docker
+func (e Env) runtime() container.Runtime {
+	if e.ContainerRuntime == "" {
+		return container.Docker
+	}
+
+	return e.ContainerRuntime
+}
+
+func newEnv(opts CreateOpts) Env {
+	return Env{
+		Name:                opts.KindClusterName,
+		ClusterProvider:     opts.ClusterProvider,
+		KubeContext:         opts.KubeContext,
+		GitServer:           opts.GitServer,
+		KindClusterName:     opts.KindClusterName,
+		GiteaContainerName:  opts.GiteaContainerName,
+		GiteaHttpPort:       opts.GiteaHttpPort,
+		GiteaSshPort:        opts.GiteaSshPort,
+		GiteaUsername:       opts.GiteaUsername,
+		GiteaPassword:       opts.GiteaPassword,
+		PrivateKeyPath:      opts.PrivateKeyPath,
+		PrivateRepos:        opts.PrivateRepos,
+		GiteaDataVolume:     opts.GiteaContainer.DataVolume,
+		FluxBootstrapRepo:   opts.FluxBootstrapRepo,
+		FluxPath:            opts.FluxPath,
+		GiteaLocalRepoPaths: opts.GiteaLocalRepoPaths,
+		CreatedAt:           time.Now(),
+	}
+}
+
+// envPath returns where the state of the environment is saved
+func envPath(name string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config dir: %w", err)
+	}
+
+	return filepath.Join(configDir, "integration", "envs", name+".json"), nil
+}
+
+// saveEnv saves the state of the environment, the file holds the gitea password and token so only the user can read it.
+func saveEnv(env Env) error {
+	p, err := envPath(env.Name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(p), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create envs dir: %w", err)
+	}
+
+	body, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(p, body, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save env %s: %w", env.Name, err)
+	}
+
+	return nil
+}
+
+// LoadEnv loads the saved state of the environment
+func LoadEnv(name string) (Env, error) {
+	var env Env
+
+	p, err := envPath(name)
+	if err != nil {
+		return env, err
+	}
+
+	body, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return env, fmt.Errorf("environment %s not found", name)
+		}
+		return env, err
+	}
+
+	err = json.Unmarshal(body, &env)
+	if err != nil {
+		return env, fmt.Errorf("failed to decode env %s: %w", name, err)
+	}
+
+	return env, nil
+}
+
+func removeEnv(name string) error {
+	p, err := envPath(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Attach returns a client of an existing environment without creating anything.
+func Attach(ctx context.Context, envName string, runner exec.Runner, out io.Writer) (*Client, error) {
+
+	env, err := LoadEnv(envName)
+	if err != nil {
+		return nil, err
+	}
+
+	giteaOpts := gitea.Opts{
+		Addr:     "http://localhost",
+		SSHPort:  env.GiteaSshPort,
+		HttpPort: env.GiteaHttpPort,
+		Runtime:  env.runtime(),
+	}
+
+	c, err := NewClient(giteaOpts, runner, out)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.attach(ctx, env)
+	if err != nil {
+		return nil, c.redactor.Error(fmt.Errorf("failed to attach to environment %s: %w", envName, err))
+	}
+
+	return c, nil
+}
+
+// Env returns the environment the client works with, it's nil before the environment was created or attached.
+func (c *Client) Env() *Env {
+	return c.env
+}
+
+// attach makes sure the environment is running and initializes the clients to work with it.
+func (c *Client) attach(ctx context.Context, env Env) error {
+
+	c.redactor.Add(env.GiteaPassword, env.GiteaToken, env.PrivateKeyPath)
+
+	provider, err := c.clusterProvider(env.ClusterProvider, env.KubeContext)
+	if err != nil {
+		return err
+	}
+
+	git, err := c.newGitServer(env.gitServerOpts())
+	if err != nil {
+		return err
+	}
+
+	exists, err := c.envExists(ctx, provider, git, env.KindClusterName)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("%s cluster %s and %s don't exist", provider.Name(), env.KindClusterName, git)
+	}
+
+	err = git.Attach(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.git = git
+
+	// Save the token created for an environment saved without one, so it's created only once
+	if git.Token() != env.GiteaToken {
+		c.redactor.Add(git.Token())
+		env.GiteaToken = git.Token()
+
+		err = saveEnv(env)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.fluxClient.UseContext(provider.KubeContext(env.KindClusterName))
+	err = c.fluxClient.Initialize()
+	if err != nil {
+		return fmt.Errorf("failed to initialize flux client: %w", err)
+	}
+
+	c.env = &env
+
+	return nil
+}
+
+// envExists checks if both the cluster and the git server exist.
+// it fails if only one of them exists since such environment can't be used, except for an existing
+// cluster without the git server which is what a first run on it finds.
+func (c *Client) envExists(ctx context.Context, provider cluster.Provider, git gitServer, clusterName string) (bool, error) {
+
+	clusterExists, err := provider.Exists(ctx, clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	gitExists, err := git.Exists(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case clusterExists && gitExists:
+		return true, nil
+
+	// The existing cluster isn't ours to delete
+	case clusterExists && provider.Name() == "existing":
+		return false, nil
+
+	case clusterExists:
+		return false, fmt.Errorf("%s cluster %s exists without %s, delete it first", provider.Name(), clusterName, git)
+
+	case gitExists:
+		return false, fmt.Errorf("%s exists without %s cluster %s, delete it first", git, provider.Name(), clusterName)
+	}
+
+	return false, nil
+}
+
+// adoptEnv reuses an existing environment, the local repos are synced to the git server
+// and flux is not bootstrapped again. only the network connection of the webhooks is registered with cleanup.
+func (c *Client) adoptEnv(ctx context.Context, opts CreateOpts, cleanup Cleanup) error {
+
+	fmt.Fprintf(c.out, "reusing environment %s \n", opts.KindClusterName)
+
+	env := newEnv(opts)
+	env.ContainerRuntime = c.runtime
+
+	// Keep the original creation time and the token of the cluster
+	saved, err := LoadEnv(env.Name)
+	if err == nil {
+		env.CreatedAt = saved.CreatedAt
+		env.GiteaToken = saved.GiteaToken
+	}
+
+	err = c.attach(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	env = *c.env
+
+	err = c.syncRepos(ctx, opts.GiteaLocalRepoPaths)
+	if err != nil {
+		return err
+	}
+
+	// Repos added since the environment was created need their url updated, and their webhook
+	go func() {
+		err := c.fluxClient.KSInformer(ctx, clusterRepos(opts, c.git))
+		if err != nil {
+			fmt.Fprintf(c.out, "git repositories informer stopped: %v \n", err)
+		}
+	}()
+
+	provider, err := c.clusterProvider(opts.ClusterProvider, opts.KubeContext)
+	if err != nil {
+		return err
+	}
+
+	err = c.setUpWebhooks(ctx, opts, provider, cleanup)
+	if err != nil {
+		return err
+	}
+
+	return saveEnv(env)
+}
+
+// syncRepos pushes the local repos to the git server, the repos which don't exist are created
+func (c *Client) syncRepos(ctx context.Context, repoPaths []string) error {
+	errCh := make(chan error)
+	for _, repoPath := range repoPaths {
+		go func(repoPath string) {
+			repoName := path.Base(repoPath)
+
+			errCh <- c.phase("repos", repoName, func() error {
+				return c.git.Push(ctx, repoName, repoPath)
+			})
+		}(repoPath)
+	}
+
+	var genErr error
+	for i := 0; i < len(repoPaths); i++ {
+		genErr = errors.Join(genErr, <-errCh)
+	}
+
+	if genErr != nil {
+		return fmt.Errorf("failed to sync local repos to %s: %w", c.git.Name(), genErr)
+	}
+
+	return nil
+}
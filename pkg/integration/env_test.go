@@ -0,0 +1,50 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ezratameno/integration/pkg/cluster"
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	cluster.Provider
+	name   string
+	exists bool
+}
+
+func (p fakeProvider) Name() string { return p.name }
+
+func (p fakeProvider) Exists(ctx context.Context, name string) (bool, error) { return p.exists, nil }
+
+type fakeGitServer struct {
+	gitServer
+	exists bool
+}
+
+func (s fakeGitServer) String() string { return "gitea container gitea" }
+
+func (s fakeGitServer) Exists(ctx context.Context) (bool, error) { return s.exists, nil }
+
+func TestEnvExists(t *testing.T) {
+	c, err := NewClient(gitea.Opts{}, exec.NewFakeRunner(), io.Discard)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	exists, err := c.envExists(ctx, fakeProvider{name: "kind", exists: true}, fakeGitServer{exists: true}, "integration")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	_, err = c.envExists(ctx, fakeProvider{name: "kind", exists: true}, fakeGitServer{}, "integration")
+	require.ErrorContains(t, err, "delete it first")
+
+	// A first run on an existing cluster creates the git server
+	exists, err = c.envExists(ctx, fakeProvider{name: "existing", exists: true}, fakeGitServer{}, "integration")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
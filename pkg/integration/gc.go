@@ -0,0 +1,384 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/kind"
+	"github.com/ezratameno/integration/pkg/owner"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type GCOpts struct {
+	// OlderThan removes only the environments created more than this long ago
+	OlderThan time.Duration
+
+	// DryRun reports the stale environments without removing them
+	DryRun bool
+}
+
+// staleEnv is an environment gc removes, env is nil when only its labelled containers were found
+type staleEnv struct {
+	name       string
+	createdAt  time.Time
+	env        *Env
+	containers []container.Container
+}
+
+// GC removes the environments of the current user created before OlderThan, with their containers,
+// deploy key files and kube contexts. the environments are found by their saved state and by the labels
+// of the containers of docker and podman, so also what runs which crashed left behind is found.
+// it returns the names of the stale environments.
+func (c *Client) GC(ctx context.Context, opts GCOpts) ([]string, error) {
+
+	names, err := listEnvs()
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []Env
+	for _, name := range names {
+		env, err := LoadEnv(name)
+		if err != nil {
+			fmt.Fprintf(c.out, "skipping env %s: %s \n", name, err)
+			continue
+		}
+
+		envs = append(envs, env)
+	}
+
+	containers := c.listContainers(ctx)
+
+	stale := findStale(envs, containers, time.Now().Add(-opts.OlderThan))
+
+	var removed []string
+	var genErr error
+	for _, s := range stale {
+		fmt.Fprintf(c.out, "environment %s created at %s is stale \n", s.name, s.createdAt.Format(time.RFC3339))
+		removed = append(removed, s.name)
+
+		if opts.DryRun {
+			continue
+		}
+
+		err := c.removeStale(ctx, s)
+		if err != nil {
+			genErr = errors.Join(genErr, fmt.Errorf("failed to remove environment %s: %w", s.name, err))
+			continue
+		}
+
+		fmt.Fprintf(c.out, "removed environment %s \n", s.name)
+	}
+
+	return removed, c.redactor.Error(genErr)
+}
+
+// listContainers returns the containers of the environments of docker and podman, the runtime of the
+// client first. a runtime which fails to list its containers, like when it isn't installed, is skipped.
+// the kind nodes can't have container labels, so they get the owner labels of their kubernetes nodes.
+func (c *Client) listContainers(ctx context.Context) []container.Container {
+	runtimes := []container.Runtime{c.runtime}
+	for _, rt := range []container.Runtime{container.Docker, container.Podman} {
+		if rt != c.runtime {
+			runtimes = append(runtimes, rt)
+		}
+	}
+
+	// docker may be podman, its containers are kept with the first runtime
+	seen := make(map[string]bool)
+
+	var containers []container.Container
+	for _, rt := range runtimes {
+		labelled, err := rt.List(ctx, c.runner, owner.EnvLabel)
+		if err != nil {
+			fmt.Fprintf(c.out, "skipping %s containers: %s \n", rt, err)
+			continue
+		}
+
+		nodes, err := c.withRuntime(rt).kindNodes(ctx)
+		if err != nil {
+			fmt.Fprintf(c.out, "skipping %s kind nodes: %s \n", rt, err)
+		}
+
+		for _, ct := range append(labelled, nodes...) {
+			if seen[ct.Name] {
+				continue
+			}
+
+			seen[ct.Name] = true
+			containers = append(containers, ct)
+		}
+	}
+
+	return containers
+}
+
+// kindNodes returns the control plane nodes of the kind clusters with the owner labels of their
+// kubernetes nodes, the nodes which are stopped or have no owner labels are skipped.
+func (c *Client) kindNodes(ctx context.Context) ([]container.Container, error) {
+	nodes, err := c.runtime.List(ctx, c.runner, kind.ControlPlaneLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	kindClient := c.providers["kind"].(*kind.Client)
+
+	var owned []container.Container
+	for _, node := range nodes {
+		labels, err := kindClient.NodeLabels(ctx, node.Name)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := labels[owner.EnvLabel]; !ok {
+			continue
+		}
+
+		if node.Labels == nil {
+			node.Labels = make(map[string]string)
+		}
+
+		for _, key := range []string{owner.EnvLabel, owner.CreatedAtLabel, owner.OwnerLabel} {
+			node.Labels[key] = labels[key]
+		}
+
+		owned = append(owned, node)
+	}
+
+	return owned, nil
+}
+
+// findStale returns the environments created before the cutoff sorted by name. the containers
+// of the saved environments are removed with them, the other containers are grouped by the
+// environment of their labels. the containers of other users are ignored.
+func findStale(envs []Env, containers []container.Container, cutoff time.Time) []*staleEnv {
+
+	saved := make(map[string]bool)
+	stale := make(map[string]*staleEnv)
+
+	for i, env := range envs {
+		saved[env.Name] = true
+
+		if env.CreatedAt.Before(cutoff) {
+			stale[env.Name] = &staleEnv{
+				name:      env.Name,
+				createdAt: env.CreatedAt,
+				env:       &envs[i],
+			}
+		}
+	}
+
+	for _, ct := range containers {
+		if !owner.Owned(ct.Labels) {
+			continue
+		}
+
+		name := ct.Labels[owner.EnvLabel]
+		if saved[name] {
+			continue
+		}
+
+		createdAt, err := owner.CreatedAt(ct.Labels)
+		if err != nil || !createdAt.Before(cutoff) {
+			continue
+		}
+
+		s, ok := stale[name]
+		if !ok {
+			s = &staleEnv{name: name, createdAt: createdAt}
+			stale[name] = s
+		}
+
+		if createdAt.Before(s.createdAt) {
+			s.createdAt = createdAt
+		}
+
+		s.containers = append(s.containers, ct)
+	}
+
+	res := make([]*staleEnv, 0, len(stale))
+	for _, s := range stale {
+		res = append(res, s)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].name < res[j].name
+	})
+
+	return res
+}
+
+// removeStale removes what exists of the environment with its key files and kube context
+func (c *Client) removeStale(ctx context.Context, s *staleEnv) error {
+	if s.env == nil {
+		return c.removeContainers(ctx, s.containers)
+	}
+
+	env := s.env
+	c = c.withRuntime(env.runtime())
+
+	provider, err := c.clusterProvider(env.ClusterProvider, env.KubeContext)
+	if err != nil {
+		return err
+	}
+
+	git, err := c.newGitServer(env.gitServerOpts())
+	if err != nil {
+		return err
+	}
+
+	var genErr error
+
+	// The network of the cluster is removed with it only when gitea isn't connected to it
+	if network := provider.Network(env.KindClusterName); network != "" {
+		genErr = errors.Join(genErr, git.DisconnectNetwork(ctx, network))
+	}
+
+	exists, err := provider.Exists(ctx, env.KindClusterName)
+	if err == nil && exists {
+		err = provider.Delete(ctx, env.KindClusterName)
+	}
+	genErr = errors.Join(genErr, err)
+
+	exists, err = git.Exists(ctx)
+	if err == nil && exists {
+		err = git.Delete(ctx)
+	}
+	genErr = errors.Join(genErr, err)
+
+	// The key files are left behind when the server was already gone
+	for _, repo := range repoNames(env.GiteaLocalRepoPaths) {
+		genErr = errors.Join(genErr, removeFile(env.gitServerOpts().deployKeyPath(repo)))
+	}
+
+	// The context of an existing cluster isn't ours
+	if provider.Name() != "existing" {
+		genErr = errors.Join(genErr, removeKubeContext(provider.KubeContext(env.KindClusterName)))
+	}
+
+	genErr = errors.Join(genErr, removeSnapshots(env.Name))
+
+	// The state is kept until everything is removed, so gc can try again
+	if genErr != nil {
+		return genErr
+	}
+
+	return removeEnv(env.Name)
+}
+
+// removeContainers removes the containers of an environment which wasn't saved with their runtimes,
+// the nodes of kind and k3d clusters are removed with the cluster.
+func (c *Client) removeContainers(ctx context.Context, containers []container.Container) error {
+
+	byRuntime := make(map[container.Runtime][]container.Container)
+	for _, ct := range containers {
+		rt := ct.Runtime
+		if rt == "" {
+			rt = c.runtime
+		}
+
+		byRuntime[rt] = append(byRuntime[rt], ct)
+	}
+
+	var genErr error
+	for rt, containers := range byRuntime {
+		genErr = errors.Join(genErr, c.withRuntime(rt).removeRuntimeContainers(ctx, containers))
+	}
+
+	return genErr
+}
+
+// removeRuntimeContainers removes the containers of the runtime of the client
+func (c *Client) removeRuntimeContainers(ctx context.Context, containers []container.Container) error {
+
+	kindClusters := make(map[string]bool)
+	k3dClusters := make(map[string]bool)
+	var names []string
+
+	for _, ct := range containers {
+		if cluster, ok := ct.Labels[kind.ClusterLabel]; ok {
+			kindClusters[cluster] = true
+			continue
+		}
+
+		if cluster, ok := ct.Labels["k3d.cluster"]; ok {
+			k3dClusters[cluster] = true
+			continue
+		}
+
+		names = append(names, ct.Name)
+	}
+
+	var genErr error
+
+	// kind removes the cluster from the kubeconfig itself
+	for cluster := range kindClusters {
+		genErr = errors.Join(genErr, c.providers["kind"].Delete(ctx, cluster))
+	}
+
+	for cluster := range k3dClusters {
+		provider := c.providers["k3d"]
+
+		err := provider.Delete(ctx, cluster)
+		genErr = errors.Join(genErr, err)
+
+		if err == nil {
+			genErr = errors.Join(genErr, removeKubeContext(provider.KubeContext(cluster)))
+		}
+	}
+
+	if len(names) > 0 {
+		_, err := c.runner.Run(ctx, c.runtime.Command(append([]string{"container", "rm", "-f"}, names...)...))
+		if err != nil {
+			genErr = errors.Join(genErr, fmt.Errorf("failed to remove containers: %w", err))
+		}
+	}
+
+	return genErr
+}
+
+// removeKubeContext removes the context from the kubeconfig, with its cluster and user
+// when no other context uses them. it does nothing if the context doesn't exist.
+func removeKubeContext(name string) error {
+	pathOptions := clientcmd.NewDefaultPathOptions()
+
+	config, err := pathOptions.GetStartingConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	kubeContext, ok := config.Contexts[name]
+	if !ok {
+		return nil
+	}
+
+	delete(config.Contexts, name)
+	if config.CurrentContext == name {
+		config.CurrentContext = ""
+	}
+
+	clusterUsed, userUsed := false, false
+	for _, other := range config.Contexts {
+		clusterUsed = clusterUsed || other.Cluster == kubeContext.Cluster
+		userUsed = userUsed || other.AuthInfo == kubeContext.AuthInfo
+	}
+
+	if !clusterUsed {
+		delete(config.Clusters, kubeContext.Cluster)
+	}
+
+	if !userUsed {
+		delete(config.AuthInfos, kubeContext.AuthInfo)
+	}
+
+	err = clientcmd.ModifyConfig(pathOptions, *config, true)
+	if err != nil {
+		return fmt.Errorf("failed to remove context %s from kubeconfig: %w", name, err)
+	}
+
+	return nil
+}
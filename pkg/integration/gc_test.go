@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/ezratameno/integration/pkg/owner"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindStale(t *testing.T) {
+
+	now := time.Now()
+	cutoff := now.Add(-2 * time.Hour)
+
+	envs := []Env{
+		{Name: "old", CreatedAt: now.Add(-3 * time.Hour)},
+		{Name: "new", CreatedAt: now.Add(-time.Hour)},
+	}
+
+	labels := func(env string, createdAt time.Time) map[string]string {
+		return owner.Labels(env, createdAt)
+	}
+
+	someoneElse := labels("other", now.Add(-5*time.Hour))
+	someoneElse[owner.OwnerLabel] = "someone-else"
+
+	containers := []container.Container{
+		// Removed with their saved environments
+		{Name: "gitea-old", Labels: labels("old", now.Add(-3*time.Hour))},
+		{Name: "gitea-new", Labels: labels("new", now.Add(-3*time.Hour))},
+
+		// Left behind by a crashed run
+		{Name: "k3d-crashed-server-0", Labels: labels("crashed", now.Add(-4*time.Hour))},
+		{Name: "gitea-crashed", Labels: labels("crashed", now.Add(-5*time.Hour))},
+
+		{Name: "gitea-running", Labels: labels("running", now.Add(-time.Minute))},
+		{Name: "gitea-other", Labels: someoneElse},
+	}
+
+	stale := findStale(envs, containers, cutoff)
+	require.Len(t, stale, 2)
+
+	require.Equal(t, "crashed", stale[0].name)
+	require.Nil(t, stale[0].env)
+	require.Len(t, stale[0].containers, 2)
+	require.Equal(t, now.Add(-5*time.Hour).UTC().Truncate(time.Second), stale[0].createdAt)
+
+	require.Equal(t, "old", stale[1].name)
+	require.Equal(t, "old", stale[1].env.Name)
+	require.Empty(t, stale[1].containers)
+}
+
+func TestListContainers(t *testing.T) {
+
+	createdAt := time.Now().Add(-3 * time.Hour)
+	labels, err := json.Marshal(owner.Labels("crashed", createdAt))
+	require.NoError(t, err)
+
+	inspect := "docker container inspect --format {{.Name}}\t{{json .Config.Labels}} "
+	runner := exec.NewFakeRunner().
+		On("docker ps -a -q --filter label="+owner.EnvLabel, exec.Result{Stdout: []byte("1a\n")}, nil).
+		On(inspect+"1a", exec.Result{Stdout: []byte("/gitea-crashed\t" + string(labels) + "\n")}, nil).
+		On("docker ps -a -q --filter label=io.x-k8s.kind.role=control-plane", exec.Result{Stdout: []byte("2b\n3c\n4d\n")}, nil).
+		On(inspect+"2b 3c 4d", exec.Result{Stdout: []byte(
+			"/crashed-control-plane\t{\"io.x-k8s.kind.cluster\":\"crashed\"}\n" +
+				"/stopped-control-plane\t{\"io.x-k8s.kind.cluster\":\"stopped\"}\n" +
+				"/other-control-plane\t{\"io.x-k8s.kind.cluster\":\"other\"}\n")}, nil).
+		On("docker exec crashed-control-plane", exec.Result{Stdout: labels}, nil).
+		OnExit("docker exec stopped-control-plane", 1, "Error response from daemon: container is not running").
+		On("docker exec other-control-plane", exec.Result{Stdout: []byte(`{"kubernetes.io/os":"linux"}`)}, nil).
+		OnExit("podman ps", 127, "podman: command not found")
+
+	var out bytes.Buffer
+	c, err := NewClient(gitea.Opts{Runtime: container.Docker}, runner, &out)
+	require.NoError(t, err)
+
+	containers := c.listContainers(context.Background())
+	require.Len(t, containers, 2)
+	require.Equal(t, "gitea-crashed", containers[0].Name)
+
+	// The kind node gets the owner labels of its kubernetes node
+	require.Equal(t, "crashed-control-plane", containers[1].Name)
+	require.Equal(t, "crashed", containers[1].Labels[owner.EnvLabel])
+	require.Equal(t, "crashed", containers[1].Labels["io.x-k8s.kind.cluster"])
+	require.Equal(t, container.Docker, containers[1].Runtime)
+
+	// The runtime which failed is skipped
+	require.Contains(t, out.String(), "skipping podman containers")
+}
@@ -0,0 +1,661 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	giteasdk "code.gitea.io/sdk/gitea"
+	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/ezratameno/integration/pkg/gitserver"
+	"github.com/ezratameno/integration/pkg/owner"
+)
+
+// gitServer hosts the local repos flux is bootstrapped with and syncs from, with its lifecycle and how
+// the cluster reaches it. the server isn't pluggable, it's chosen by the GitServer option by name,
+// gitea or local, see newGitServer.
+type gitServer interface {
+	// CreateRepo creates the repo with the files of the local repo, what it creates is registered with cleanup
+	CreateRepo(ctx context.Context, cleanup Cleanup, name string, localPath string) error
+
+	// Push syncs the files of the local repo to the repo, it's created when it doesn't exist
+	Push(ctx context.Context, name string, localPath string) error
+
+	// Credentials flux bootstrap authenticates with
+	Credentials() GitCredentials
+
+	// CloneURL returns the url to clone the repo from this host
+	CloneURL(repo string) string
+
+	// Name of the kind of the server, gitea or local. it's saved with the environment
+	Name() string
+
+	// String describes the server, like the name of its container
+	String() string
+
+	// Start starts the server, what it creates is registered with cleanup as soon as it's created
+	Start(ctx context.Context, cleanup Cleanup) error
+
+	// Attach starts the server of an existing environment and waits for it to be ready
+	Attach(ctx context.Context) error
+
+	// WaitReady waits until the server is ready after it was restarted
+	WaitReady(ctx context.Context) error
+
+	// Exists checks if the server of the environment exists
+	Exists(ctx context.Context) (bool, error)
+
+	// Delete removes the server, its repos and the private keys of the repos
+	Delete(ctx context.Context) error
+
+	// ClusterCredentials the cluster clones the repos with over http
+	ClusterCredentials() GitCredentials
+
+	// Token returns the access token the cluster clones with, it's saved with the environment.
+	// empty when the server has no tokens
+	Token() string
+
+	// DeployKeyPath returns the private key of the deploy key of the repo, empty when the repo has none
+	DeployKeyPath(repo string) string
+
+	// URL returns the address of the server from this host
+	URL() string
+
+	// RepoURL returns the page of the repo from this host
+	RepoURL(repo string) string
+
+	// ClusterURL returns the url the cluster clones the repo from
+	ClusterURL(repo string) (string, error)
+
+	// BootstrapURL returns the url flux bootstrap pushes the repo to
+	BootstrapURL(repo string) (string, error)
+
+	// Containers returns the containers of the server, they are saved in the snapshots
+	Containers() []string
+
+	// AddWebhooks adds a webhook which calls the url on every push to each repo, the server is
+	// connected to the container network first so it can reach the url
+	AddWebhooks(ctx context.Context, cleanup Cleanup, network, url string) error
+
+	// DisconnectNetwork disconnects the server from the container network of the cluster,
+	// so the network can be removed with the cluster
+	DisconnectNetwork(ctx context.Context, network string) error
+}
+
+type GitCredentials struct {
+	Username string
+	Password string
+
+	// PrivateKeyPath of the ssh key flux bootstrap pushes with, empty when it pushes over http
+	PrivateKeyPath string
+}
+
+const (
+	GitServerGitea = "gitea"
+	GitServerLocal = "local"
+)
+
+// gitServerOpts describe the git server of an environment
+type gitServerOpts struct {
+	kind           string
+	envName        string
+	containerName  string
+	httpPort       int
+	sshPort        int
+	username       string
+	password       string
+	privateKeyPath string
+
+	// keyAlgorithm of the deploy keys
+	keyAlgorithm gitea.KeyAlgorithm
+
+	// bootstrapRepo is the repo flux bootstrap pushes to, its deploy key can write
+	bootstrapRepo string
+
+	// repos are the names of the repos
+	repos []string
+
+	// privateRepos creates the repos private, so they can only be cloned with credentials
+	privateRepos bool
+
+	// token is the saved access token of the environment, a new one is created when it's empty
+	token string
+
+	// container configures the gitea container, only its data volume is needed to delete it
+	container gitea.ContainerOpts
+
+	// keepVolume keeps the data volume of the container when it's deleted
+	keepVolume bool
+}
+
+func (o CreateOpts) gitServerOpts() gitServerOpts {
+	return gitServerOpts{
+		kind:           o.GitServer,
+		envName:        o.KindClusterName,
+		containerName:  o.GiteaContainerName,
+		httpPort:       o.GiteaHttpPort,
+		sshPort:        o.GiteaSshPort,
+		username:       o.GiteaUsername,
+		password:       o.GiteaPassword,
+		privateKeyPath: o.PrivateKeyPath,
+		keyAlgorithm:   o.KeyAlgorithm,
+		bootstrapRepo:  path.Base(o.FluxBootstrapRepo),
+		repos:          repoNames(o.GiteaLocalRepoPaths),
+		privateRepos:   o.PrivateRepos,
+		container:      o.giteaContainer(),
+	}
+}
+
+// giteaContainer returns the options of the gitea container with the labels of the environment
+func (o CreateOpts) giteaContainer() gitea.ContainerOpts {
+	container := o.GiteaContainer
+	container.Labels = owner.Merge(o.GiteaContainer.Labels, o.Labels)
+	return container
+}
+
+func (e Env) gitServerOpts() gitServerOpts {
+	return gitServerOpts{
+		kind:           e.GitServer,
+		envName:        e.Name,
+		containerName:  e.GiteaContainerName,
+		httpPort:       e.GiteaHttpPort,
+		sshPort:        e.GiteaSshPort,
+		username:       e.GiteaUsername,
+		password:       e.GiteaPassword,
+		privateKeyPath: e.PrivateKeyPath,
+		bootstrapRepo:  path.Base(e.FluxBootstrapRepo),
+		repos:          repoNames(e.GiteaLocalRepoPaths),
+		privateRepos:   e.PrivateRepos,
+		token:          e.GiteaToken,
+		container:      gitea.ContainerOpts{DataVolume: e.GiteaDataVolume},
+	}
+}
+
+func repoNames(repoPaths []string) []string {
+	var names []string
+	for _, repoPath := range repoPaths {
+		names = append(names, path.Base(repoPath))
+	}
+
+	return names
+}
+
+// deployKeyPath returns where the private key of the deploy key of the repo is saved,
+// the key of the bootstrap repo is saved to the private key path and the keys of the other
+// repos next to it.
+func (o gitServerOpts) deployKeyPath(repo string) string {
+	if repo == o.bootstrapRepo {
+		return o.privateKeyPath
+	}
+
+	return fmt.Sprintf("%s-%s.pem", strings.TrimSuffix(o.privateKeyPath, ".pem"), repo)
+}
+
+// newGitServer returns the git server of the options, gitea when the kind is empty
+func (c *Client) newGitServer(opts gitServerOpts) (gitServer, error) {
+	switch opts.kind {
+	case "", GitServerGitea:
+		return &giteaServer{
+			client: c.giteaClient,
+			opts:   opts,
+			token:  opts.token,
+			phase:  c.phase,
+		}, nil
+
+	case GitServerLocal:
+		dir, err := gitReposDir(opts.envName)
+		if err != nil {
+			return nil, err
+		}
+
+		return &localServer{
+			server: gitserver.New(gitserver.Opts{
+				Dir:      dir,
+				Port:     opts.httpPort,
+				Username: opts.username,
+				Password: opts.password,
+			}, c.runner, c.out),
+			dir:  dir,
+			opts: opts,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown git server %q, use gitea or local", opts.kind)
+}
+
+// gitReposDir returns where the local git server keeps the repos of the environment
+func gitReposDir(envName string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache dir: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "integration", "git", envName), nil
+}
+
+// giteaServer runs gitea in a container, flux bootstrap pushes over ssh and the cluster clones over http
+// with an access token which can only read the repos. every repo has a deploy key, only the key of the
+// bootstrap repo can push.
+type giteaServer struct {
+	client *gitea.Client
+	opts   gitServerOpts
+	token  string
+
+	// phase records the start of the container in the report
+	phase func(suite, name string, fn func() error) error
+}
+
+func (s *giteaServer) Name() string {
+	return GitServerGitea
+}
+
+func (s *giteaServer) String() string {
+	return fmt.Sprintf("gitea container %s", s.opts.containerName)
+}
+
+func (s *giteaServer) startOpts() gitea.StartContainerOpts {
+	return gitea.StartContainerOpts{
+		Email:         fmt.Sprintf("%s@gmail.com", s.opts.username),
+		Password:      s.opts.password,
+		Username:      s.opts.username,
+		ContainerName: s.opts.containerName,
+		ContainerOpts: s.opts.container,
+	}
+}
+
+// Start starts the gitea container
+func (s *giteaServer) Start(ctx context.Context, cleanup Cleanup) error {
+
+	// A volume which already exists keeps the data of an earlier container, we only remove the one we create.
+	// it's registered before the container so it's removed after it.
+	if volume := s.opts.container.DataVolume; volume != "" {
+		exists, err := s.client.VolumeExists(ctx, volume)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			cleanup(fmt.Sprintf("gitea volume %s", volume), func(ctx context.Context) error {
+				return s.client.DeleteVolume(ctx, volume)
+			})
+		}
+	}
+
+	// Start github
+	var containerName string
+	err := s.phase("gitea", "start container", func() error {
+		var err error
+		containerName, err = s.client.Start(ctx, s.startOpts())
+		return err
+	})
+
+	// The container exists unless we failed to create it
+	if !errors.Is(err, gitea.ErrCreateContainer) {
+		cleanup(fmt.Sprintf("gitea container %s", containerName), func(ctx context.Context) error {
+			return s.client.Delete(ctx, containerName)
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to start gitea: %w", err)
+	}
+
+	return s.phase("gitea", "access token", func() error {
+		token, err := s.createToken()
+		if err != nil {
+			return err
+		}
+
+		cleanup(fmt.Sprintf("gitea access token %s", token.Name), func(ctx context.Context) error {
+			return s.client.DeleteAccessToken(token.ID)
+		})
+
+		return nil
+	})
+}
+
+// createToken creates the access token the cluster clones with, the names of the tokens have to be unique
+// so they are named after the time they were created.
+func (s *giteaServer) createToken() (*giteasdk.AccessToken, error) {
+	token, err := s.client.CreateAccessToken(fmt.Sprintf("%s%d", s.tokenPrefix(), time.Now().Unix()))
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = token.Token
+
+	return token, nil
+}
+
+// tokenPrefix starts the names of the access tokens of the environment
+func (s *giteaServer) tokenPrefix() string {
+	return fmt.Sprintf("%s-flux-", s.opts.envName)
+}
+
+// revokeTokens deletes the access tokens of the environment, gitea has to be running
+func (s *giteaServer) revokeTokens() error {
+	err := s.client.Login(s.startOpts())
+	if err != nil {
+		return err
+	}
+
+	return s.client.DeleteAccessTokens(s.tokenPrefix())
+}
+
+// Attach starts the container, an access token is created for the environments saved without one
+func (s *giteaServer) Attach(ctx context.Context) error {
+	err := s.client.StartExisting(ctx, s.opts.containerName)
+	if err != nil {
+		return err
+	}
+
+	err = s.client.WaitReady(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.client.Login(s.startOpts())
+	if err != nil {
+		return err
+	}
+
+	if s.token != "" {
+		return nil
+	}
+
+	_, err = s.createToken()
+	return err
+}
+
+func (s *giteaServer) WaitReady(ctx context.Context) error {
+	return s.client.WaitReady(ctx)
+}
+
+func (s *giteaServer) Exists(ctx context.Context) (bool, error) {
+	return s.client.ContainerExists(ctx, s.opts.containerName)
+}
+
+// Delete removes the container and its data volume unless it's kept, the deploy keys are removed
+// with it so only their private keys are left
+func (s *giteaServer) Delete(ctx context.Context) error {
+	var genErr error
+
+	// The tokens are revoked while gitea runs, they only outlive the container in a kept data volume
+	// so a gitea which isn't running fails the delete only then
+	if s.opts.token != "" {
+		exists, err := s.Exists(ctx)
+		if err == nil && exists {
+			err = s.revokeTokens()
+		}
+		if err != nil && s.opts.container.DataVolume != "" && s.opts.keepVolume {
+			genErr = errors.Join(genErr, fmt.Errorf("failed to revoke the access tokens: %w", err))
+		}
+	}
+
+	genErr = errors.Join(genErr, s.client.Delete(ctx, s.opts.containerName))
+
+	if s.opts.container.DataVolume != "" && !s.opts.keepVolume {
+		genErr = errors.Join(genErr, s.client.DeleteVolume(ctx, s.opts.container.DataVolume))
+	}
+
+	for _, repo := range s.opts.repos {
+		genErr = errors.Join(genErr, removeFile(s.opts.deployKeyPath(repo)))
+	}
+
+	return genErr
+}
+
+// CreateRepo creates the repo and its deploy key
+func (s *giteaServer) CreateRepo(ctx context.Context, cleanup Cleanup, name string, localPath string) error {
+	_, err := s.client.CreateRepoFromExisting(ctx, giteaRepoOpts(name, s.opts.privateRepos), localPath)
+	if err != nil {
+		return err
+	}
+
+	keyPath := s.opts.deployKeyPath(name)
+	key, err := s.client.CreateDeployKey(ctx, gitea.DeployKeyOpts{
+		Repo:           name,
+		Title:          fmt.Sprintf("%s-%s", s.opts.envName, name),
+		Algorithm:      s.opts.keyAlgorithm,
+		ReadOnly:       name != s.opts.bootstrapRepo,
+		PrivateKeyPath: keyPath,
+	})
+	if key != nil {
+		cleanup(fmt.Sprintf("gitea deploy key %s", key.Title), func(ctx context.Context) error {
+			return s.client.DeleteDeployKey(name, key.ID)
+		})
+
+		cleanup(fmt.Sprintf("private key file %s", keyPath), func(ctx context.Context) error {
+			return removeFile(keyPath)
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to create deploy key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *giteaServer) Push(ctx context.Context, name string, localPath string) error {
+	_, err := s.client.SyncRepoFromExisting(ctx, giteaRepoOpts(name, s.opts.privateRepos), localPath)
+	return err
+}
+
+func giteaRepoOpts(name string, private bool) giteasdk.CreateRepoOption {
+	return giteasdk.CreateRepoOption{
+		Name:       name,
+		Private:    private,
+		TrustModel: giteasdk.TrustModelCollaboratorCommitter,
+	}
+}
+
+func (s *giteaServer) Credentials() GitCredentials {
+	return GitCredentials{
+		Username:       s.opts.username,
+		Password:       s.opts.password,
+		PrivateKeyPath: s.opts.privateKeyPath,
+	}
+}
+
+// ClusterCredentials are the access token, gitea takes it as the password of the user
+func (s *giteaServer) ClusterCredentials() GitCredentials {
+	return GitCredentials{
+		Username: s.opts.username,
+		Password: s.token,
+	}
+}
+
+func (s *giteaServer) Token() string {
+	return s.token
+}
+
+func (s *giteaServer) DeployKeyPath(repo string) string {
+	return s.opts.deployKeyPath(repo)
+}
+
+func (s *giteaServer) URL() string {
+	return fmt.Sprintf("http://localhost:%d", s.opts.httpPort)
+}
+
+func (s *giteaServer) RepoURL(repo string) string {
+	return fmt.Sprintf("http://localhost:%d/%s/%s", s.opts.httpPort, s.opts.username, repo)
+}
+
+func (s *giteaServer) CloneURL(repo string) string {
+	return fmt.Sprintf("ssh://git@localhost:%d/%s/%s.git", s.opts.sshPort, s.opts.username, repo)
+}
+
+func (s *giteaServer) ClusterURL(repo string) (string, error) {
+	ip, err := getOutboundIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("http://%s:%d/%s/%s.git", ip.String(), s.opts.httpPort, s.opts.username, repo), nil
+}
+
+func (s *giteaServer) BootstrapURL(repo string) (string, error) {
+	return s.CloneURL(repo), nil
+}
+
+func (s *giteaServer) Containers() []string {
+	return []string{s.opts.containerName}
+}
+
+func (s *giteaServer) AddWebhooks(ctx context.Context, cleanup Cleanup, network, url string) error {
+	err := s.client.ConnectNetwork(ctx, s.opts.containerName, network)
+	if err != nil {
+		return err
+	}
+
+	cleanup(fmt.Sprintf("network %s of gitea container %s", network, s.opts.containerName), func(ctx context.Context) error {
+		return s.DisconnectNetwork(ctx, network)
+	})
+
+	var genErr error
+	for _, repo := range s.opts.repos {
+		genErr = errors.Join(genErr, s.client.CreatePushWebhook(repo, url))
+	}
+
+	return genErr
+}
+
+func (s *giteaServer) DisconnectNetwork(ctx context.Context, network string) error {
+	return s.client.DisconnectNetwork(ctx, s.opts.containerName, network)
+}
+
+// localServer serves bare repos with git http-backend run by this process, the cluster can clone them only while
+// the process runs. flux bootstrap pushes and the cluster clones over http.
+type localServer struct {
+	server *gitserver.Server
+	dir    string
+	opts   gitServerOpts
+}
+
+func (s *localServer) Name() string {
+	return GitServerLocal
+}
+
+func (s *localServer) String() string {
+	return fmt.Sprintf("git repos %s", s.dir)
+}
+
+func (s *localServer) Start(ctx context.Context, cleanup Cleanup) error {
+	cleanup(s.String(), func(ctx context.Context) error {
+		return s.server.Delete()
+	})
+
+	return s.server.Start(ctx)
+}
+
+// Attach serves the repos, unless another process like create already serves them
+func (s *localServer) Attach(ctx context.Context) error {
+	serving, err := s.server.Serving(ctx)
+	if err != nil {
+		return err
+	}
+
+	if serving {
+		return nil
+	}
+
+	return s.server.Start(ctx)
+}
+
+func (s *localServer) WaitReady(ctx context.Context) error {
+	return nil
+}
+
+func (s *localServer) Exists(ctx context.Context) (bool, error) {
+	return s.server.Exists()
+}
+
+func (s *localServer) Delete(ctx context.Context) error {
+	return s.server.Delete()
+}
+
+func (s *localServer) CreateRepo(ctx context.Context, cleanup Cleanup, name string, localPath string) error {
+	return s.server.CreateRepo(ctx, name, localPath)
+}
+
+func (s *localServer) Push(ctx context.Context, name string, localPath string) error {
+	_, err := os.Stat(s.server.RepoPath(name))
+	if os.IsNotExist(err) {
+		return s.server.CreateRepo(ctx, name, localPath)
+	}
+
+	return s.server.Push(ctx, name, localPath)
+}
+
+func (s *localServer) Credentials() GitCredentials {
+	return GitCredentials{
+		Username: s.opts.username,
+		Password: s.opts.password,
+	}
+}
+
+func (s *localServer) ClusterCredentials() GitCredentials {
+	return s.Credentials()
+}
+
+func (s *localServer) Token() string {
+	return ""
+}
+
+func (s *localServer) DeployKeyPath(repo string) string {
+	return ""
+}
+
+func (s *localServer) URL() string {
+	return fmt.Sprintf("http://localhost:%d", s.opts.httpPort)
+}
+
+func (s *localServer) RepoURL(repo string) string {
+	return s.CloneURL(repo)
+}
+
+func (s *localServer) CloneURL(repo string) string {
+	return fmt.Sprintf("http://localhost:%d/%s.git", s.opts.httpPort, repo)
+}
+
+func (s *localServer) ClusterURL(repo string) (string, error) {
+	ip, err := getOutboundIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("http://%s:%d/%s.git", ip.String(), s.opts.httpPort, repo), nil
+}
+
+// BootstrapURL is the url of the cluster, so the GitRepository flux creates doesn't need to be updated
+func (s *localServer) BootstrapURL(repo string) (string, error) {
+	return s.ClusterURL(repo)
+}
+
+func (s *localServer) Containers() []string {
+	return nil
+}
+
+func (s *localServer) AddWebhooks(ctx context.Context, cleanup Cleanup, network, url string) error {
+	return fmt.Errorf("the local git server has no webhooks")
+}
+
+func (s *localServer) DisconnectNetwork(ctx context.Context, network string) error {
+	return nil
+}
+
+// removeFile removes the file, it's fine if it doesn't exist
+func removeFile(name string) error {
+	err := os.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -3,8 +3,13 @@ package integration
 import (
 	"fmt"
 	"net"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
+
+	"github.com/ezratameno/integration/pkg/existing"
+	"github.com/ezratameno/integration/pkg/gitea"
 )
 
 // Get preferred outbound ip of this machine
@@ -58,23 +63,61 @@ func validateCreateOpts(opts *CreateOpts) error {
 		return fmt.Errorf("flux bootstrap repo must be in the local repos")
 	}
 
-	// TODO: maybe generate a rand number so we can run multiple env?
+	if opts.KindClusterName == "" {
+		opts.KindClusterName = "integration"
+	}
+
+	// Every environment has its own keys so they can run side by side
 	if opts.PrivateKeyPath == "" {
-		opts.PrivateKeyPath = "/tmp/gitea-key.pem"
+		opts.PrivateKeyPath = filepath.Join(os.TempDir(), fmt.Sprintf("gitea-key-%s.pem", opts.KindClusterName))
 	}
 
 	if path.Ext(opts.PrivateKeyPath) != ".pem" {
 		return fmt.Errorf("private key path must be with pem extension")
 	}
 
-	if opts.KindClusterName == "" {
-		opts.KindClusterName = "integration"
+	keyAlgorithm, err := gitea.ParseKeyAlgorithm(string(opts.KeyAlgorithm))
+	if err != nil {
+		return err
 	}
+	opts.KeyAlgorithm = keyAlgorithm
 
-	if opts.KindConfigPath == "" {
+	if opts.ClusterProvider == "" {
+		opts.ClusterProvider = "kind"
+	}
+
+	if opts.GitServer == "" {
+		opts.GitServer = GitServerGitea
+	}
+
+	if opts.GitServer != GitServerGitea && opts.GitServer != GitServerLocal {
+		return fmt.Errorf("unknown git server %q, use gitea or local", opts.GitServer)
+	}
+
+	// The local git server has no webhooks, and gitea can't reach the nodes of an existing cluster
+	if opts.GitServer == GitServerLocal || opts.ClusterProvider == "existing" {
+		opts.SkipWebhooks = true
+	}
+
+	// k3d creates a single server cluster without a config
+	if opts.ClusterProvider == "kind" && opts.KindConfigPath == "" {
 		return fmt.Errorf("kind config path is required")
 	}
 
+	if opts.ClusterProvider == "existing" {
+		if opts.SnapshotName != "" {
+			return fmt.Errorf("snapshots are not supported with an existing cluster")
+		}
+
+		if opts.KubeContext == "" {
+			kubeContext, err := existing.CurrentContext()
+			if err != nil {
+				return err
+			}
+			opts.KubeContext = kubeContext
+		}
+	}
+
 	return nil
 
 }
@@ -1,70 +1,102 @@
 package integration
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"path"
+	"sort"
 	"strings"
-	"sync"
+	"time"
 
-	giteasdk "code.gitea.io/sdk/gitea"
+	"github.com/ezratameno/integration/pkg/cluster"
+	"github.com/ezratameno/integration/pkg/container"
 	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/ezratameno/integration/pkg/existing"
 	"github.com/ezratameno/integration/pkg/flux"
 	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/ezratameno/integration/pkg/k3d"
 	"github.com/ezratameno/integration/pkg/kind"
+	"github.com/ezratameno/integration/pkg/owner"
+	"github.com/ezratameno/integration/pkg/redact"
+	"github.com/ezratameno/integration/pkg/report"
 	"github.com/fluxcd/kustomize-controller/api/v1beta2"
+	apimeta "github.com/fluxcd/pkg/apis/meta"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
 )
 
 type Client struct {
-	kindClient  *kind.Client
+	// providers the clusters can be created with, by name
+	providers map[string]cluster.Provider
+
+	// runtime the containers are run with
+	runtime container.Runtime
+
 	giteaClient *gitea.Client
 	fluxClient  *flux.Client
-	out         io.Writer
+
+	// git hosts the repos of the environment, it's set once the environment is created or attached
+	git gitServer
+
+	runner exec.Runner
+	out    io.Writer
+
+	// redactor masks the secrets in the output and the errors
+	redactor *redact.Redactor
+
+	// report holds the phases of the runs
+	report *report.Report
+
+	// env is the environment the client works with
+	env *Env
+
+	// when the last run started and finished
+	startedAt  time.Time
+	finishedAt time.Time
 }
 
-func NewClient(opts gitea.Opts, out io.Writer) (*Client, error) {
+// NewClient returns a client that runs the containers with the runtime of the gitea options,
+// the runtime is detected when it's not set.
+func NewClient(opts gitea.Opts, runner exec.Runner, out io.Writer) (*Client, error) {
+
+	if opts.Runtime == "" {
+		opts.Runtime = container.Detect()
+	}
 
-	giteaClient := gitea.NewClient(opts, out)
+	// Everything the clients write or run goes through the redactor
+	redactor := redact.New()
+	out = redactor.Writer(out)
+	runner = redactor.Runner(runner)
 
-	kindClient := kind.NewClient()
+	giteaClient := gitea.NewClient(opts, runner, out)
 
-	fluxClient, err := flux.NewClient(out)
+	fluxClient, err := flux.NewClient(runner, out)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create flux client: %w", err)
 	}
 
 	c := &Client{
+		providers:   newProviders(opts.Runtime, runner, out),
+		runtime:     opts.Runtime,
 		giteaClient: giteaClient,
-		kindClient:  kindClient,
 		fluxClient:  fluxClient,
+		runner:      runner,
 		out:         out,
+		redactor:    redactor,
+		report:      report.New("integration"),
 	}
 
 	return c, nil
 }
 
-type cancelFuncs []func() error
-
-func (c cancelFuncs) CancelFunc() func() error {
-
-	return func() error {
-		var genErr error
-		for _, cancelFunc := range c {
-			err := cancelFunc()
-			genErr = errors.Join(genErr, err)
-		}
-
-		return genErr
-	}
-
-}
-
 type CreateOpts struct {
 
+	// GitServer hosts the local repos, gitea or local. defaults to gitea.
+	// local serves the repos with git http-backend run by this process, so the cluster can sync only while it runs
+	GitServer string
+
 	// Gitea
 
 	GiteaSshPort  int
@@ -82,19 +114,41 @@ type CreateOpts struct {
 	// The name of the repo we should bootstrap flux with, should be on of the path in GiteaLocalRepoPaths
 	FluxBootstrapRepo string
 
-	// PrivateKeyPath where to save private key
+	// PrivateKeyPath where to save the private key of the deploy key of the bootstrap repo,
+	// the keys of the other repos are saved next to it. defaults to a key of the environment in the temp dir
 	PrivateKeyPath string
 
+	// KeyAlgorithm of the deploy keys, defaults to ed25519
+	KeyAlgorithm gitea.KeyAlgorithm
+
+	// PrivateRepos creates the gitea repos private, the cluster clones them with an access token
+	PrivateRepos bool
+
+	// SkipWebhooks leaves the repos without webhooks, so the changes pushed to gitea are reconciled
+	// only on the interval of the GitRepositories. there are no webhooks with the local git server
+	// or an existing cluster
+	SkipWebhooks bool
+
 	// Kind
 
+	// ClusterProvider creates the cluster, kind or k3d. defaults to kind.
+	// existing uses the cluster of KubeContext instead of creating one
+	ClusterProvider string
+
+	// KubeContext of the existing cluster, defaults to the current context
+	KubeContext string
+
 	KindClusterName string
 
-	// Path to a kind config
+	// Path to the config of the cluster provider, a kind config or a k3d config
 	KindConfigPath string
 
-	// Image to load to the kind cluster
+	// Image to load to the kind cluster, either an image name or a path to a .tar archive
 	KindImageToLoad []string
 
+	// Pull images which are not present locally before loading them
+	KindPullImages bool
+
 	// Flux
 
 	// Path in the local repo that we should bootstrap from
@@ -102,37 +156,148 @@ type CreateOpts struct {
 
 	GiteaContainerName string
 
+	// GiteaContainer configures the gitea container, its image, app.ini overrides, data volume and limits
+	GiteaContainer gitea.ContainerOpts
+
 	// Path to kubernetes manifests to apply
 	ManifestsToApply []string
 
 	// Wait for those kustomizations to be ready
 	KustomizationsToWaitFor []types.NamespacedName
+
+	// Wait for every Kustomization and HelmRelease created under the bootstrap kustomization,
+	// including the ones created later by nested kustomizations
+	WaitForAll bool
+
+	// Skip the checks that run before creating the environment
+	SkipPreflight bool
+
+	// Keep the created resources when the run fails, so they can be debugged
+	KeepOnFailure bool
+
+	// Reuse the kind cluster and gitea container if they already exist
+	Reuse bool
+
+	// Take a snapshot with this name once the environment is ready, so it can be restored later
+	SnapshotName string
+
+	// Labels are set on the gitea container and the nodes of the cluster, Run adds to them
+	// the labels of the environment and its owner so gc can find the resources
+	Labels map[string]string
 }
 
+// Redacted returns a copy of the options with the secrets masked, so they can be printed
+func (o CreateOpts) Redacted() CreateOpts {
+	if o.GiteaPassword != "" {
+		o.GiteaPassword = redact.Mask
+	}
+
+	if o.PrivateKeyPath != "" {
+		o.PrivateKeyPath = redact.Mask
+	}
+
+	// The app.ini overrides may hold secrets, like the secret key of gitea
+	if len(o.GiteaContainer.Env) > 0 {
+		env := make(map[string]string, len(o.GiteaContainer.Env))
+		for key := range o.GiteaContainer.Env {
+			env[key] = redact.Mask
+		}
+		o.GiteaContainer.Env = env
+	}
+
+	return o
+}
+
+// Redactor returns the redactor of the client, secrets can be added to it
+// and it can be used to mask errors before they are printed.
+func (c *Client) Redactor() *redact.Redactor {
+	return c.redactor
+}
+
+// Run creates the environment and waits for it to be ready.
+// If the run fails or the context is canceled the created resources are removed,
+// unless KeepOnFailure is set and then the returned func can be used to remove them.
 func (c *Client) Run(ctx context.Context, opts CreateOpts) (func() error, error) {
+	c.startedAt = time.Now()
+	cancelFunc, err := c.run(ctx, opts)
+	c.finishedAt = time.Now()
+
+	return cancelFunc, c.redactor.Error(err)
+}
+
+func (c *Client) run(ctx context.Context, opts CreateOpts) (func() error, error) {
 
 	err := validateCreateOpts(&opts)
 	if err != nil {
 		return func() error { return nil }, err
 	}
-	cancelFunc, err := c.StartEnv(ctx, opts)
+
+	c.redactor.Add(opts.GiteaPassword, opts.PrivateKeyPath)
+
+	for _, repoPath := range opts.GiteaLocalRepoPaths {
+		c.redactor.Add(opts.gitServerOpts().deployKeyPath(path.Base(repoPath)))
+	}
+
+	// The labels of the owner win so gc can always find what we create
+	opts.Labels = owner.Merge(opts.Labels, owner.Labels(opts.KindClusterName, c.startedAt))
+
+	provider, err := c.clusterProvider(opts.ClusterProvider, opts.KubeContext)
 	if err != nil {
-		return cancelFunc, err
+		return func() error { return nil }, err
 	}
 
-	// TODO: build dependency tree of ks and reconcile by the order
+	git, err := c.newGitServer(opts.gitServerOpts())
+	if err != nil {
+		return func() error { return nil }, err
+	}
+
+	c.git = git
+
+	var adopt bool
+	if opts.Reuse {
+		adopt, err = c.envExists(ctx, provider, git, opts.KindClusterName)
+		if err != nil {
+			return func() error { return nil }, err
+		}
+	}
+
+	if !opts.SkipPreflight {
+		err = c.phase("setup", "preflight", func() error {
+			return c.preflight(ctx, opts, adopt)
+		})
+		if err != nil {
+			return func() error { return nil }, err
+		}
+	}
+
+	// Adopted resources are not registered in the rollback so a failure will not remove them,
+	// only the connection of gitea to the network of the cluster is
+	rb := newRollback(c.out)
+
+	if adopt {
+		err = c.phase("setup", "reuse", func() error {
+			return c.adoptEnv(ctx, opts, rb.add)
+		})
+	} else {
+		err = c.startEnv(ctx, opts, rb)
+	}
+
+	if err != nil {
+		return c.fail(opts, rb, err)
+	}
 
 	deps, err := c.KsDeps(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to order kustomizations by deps: %w", err)
+		return c.fail(opts, rb, fmt.Errorf("failed to order kustomizations by deps: %w", err))
 	}
 
 	// reconcile by dep
 	for _, dep := range deps {
-		err = c.fluxClient.ReconcileKS(ctx, dep)
+		err = c.phase("reconcile", dep.String(), func() error {
+			return c.fluxClient.ReconcileKS(ctx, dep)
+		})
 		if err != nil {
-			fmt.Println(err)
-			// return cancelFunc,
+			fmt.Fprintln(c.out, err)
 		}
 
 	}
@@ -141,34 +306,130 @@ func (c *Client) Run(ctx context.Context, opts CreateOpts) (func() error, error)
 		fmt.Fprintln(c.out, "waiting for kustomizations to be ready")
 	}
 
-	err = c.WaitForKs(ctx, opts.KustomizationsToWaitFor...)
+	err = c.waitForKs(ctx, opts.KustomizationsToWaitFor...)
 	if err != nil {
-		return cancelFunc, fmt.Errorf("failed to wait for kustomizations: %w", err)
+		return c.fail(opts, rb, fmt.Errorf("failed to wait for kustomizations: %w", err))
 	}
 
 	if len(opts.KustomizationsToWaitFor) > 0 {
 		fmt.Fprintln(c.out, "finish waiting for kustomizations")
 	}
 
-	return cancelFunc, nil
+	if opts.WaitForAll {
+		fmt.Fprintln(c.out, "waiting for all the flux objects to be ready")
+
+		err = c.phase("wait", "all flux objects", func() error {
+			return c.fluxClient.WaitForAll(ctx, flux.Root)
+		})
+		if err != nil {
+			return c.fail(opts, rb, fmt.Errorf("failed to wait for all the flux objects: %w", err))
+		}
+
+		fmt.Fprintln(c.out, "all the flux objects are ready")
+	}
+
+	if opts.SnapshotName != "" {
+		err = c.phase("snapshot", opts.SnapshotName, func() error {
+			return c.Snapshot(ctx, opts.SnapshotName)
+		})
+		if err != nil {
+			return c.fail(opts, rb, err)
+		}
+	}
+
+	return rb.CancelFunc(), nil
+}
+
+// fail removes the resources created so far, unless we were asked to keep them.
+func (c *Client) fail(opts CreateOpts, rb *rollback, err error) (func() error, error) {
+
+	if opts.KeepOnFailure {
+		fmt.Fprintln(c.out, "run failed, keeping the created resources")
+		return rb.CancelFunc(), err
+	}
+
+	fmt.Fprintln(c.out, "run failed, removing the created resources")
+
+	rbErr := rb.CancelFunc()()
+	if rbErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to roll back: %w", rbErr))
+	}
+
+	return func() error { return nil }, err
 }
 
 type DeleteOpts struct {
+	// ClusterProvider the cluster was created with, defaults to the one saved
+	// with the environment or to kind
+	ClusterProvider string
+
+	// GitServer the repos are hosted with, defaults to the one saved with the environment or to gitea
+	GitServer          string
 	KindClusterName    string
 	GiteaContainerName string
+
+	// KeepVolume keeps the data volume of the gitea container
+	KeepVolume bool
 }
 
-// Delete will delete the kind cluster and the gitea container.
+// Delete will delete the cluster and the git server, with the container runtime of the saved environment.
 func (c *Client) Delete(ctx context.Context, opts DeleteOpts) error {
 
+	var kubeContext string
+	env, err := LoadEnv(opts.KindClusterName)
+	if err == nil {
+		c = c.withRuntime(env.runtime())
+		kubeContext = env.KubeContext
+		if opts.ClusterProvider == "" {
+			opts.ClusterProvider = env.ClusterProvider
+		}
+		if opts.GitServer == "" {
+			opts.GitServer = env.GitServer
+		}
+	}
+
+	provider, err := c.clusterProvider(opts.ClusterProvider, kubeContext)
+	if err != nil {
+		return err
+	}
+
+	// The saved environment knows the key files of the repos
+	gitOpts := gitServerOpts{envName: opts.KindClusterName}
+	if env.Name != "" {
+		gitOpts = env.gitServerOpts()
+	}
+	gitOpts.kind = opts.GitServer
+	gitOpts.containerName = opts.GiteaContainerName
+	gitOpts.keepVolume = opts.KeepVolume
+
+	git, err := c.newGitServer(gitOpts)
+	if err != nil {
+		return err
+	}
+
 	var genErr error
 
-	err := c.kindClient.DeleteCluster(opts.KindClusterName)
+	// The network of the cluster is removed with it only when gitea isn't connected to it
+	if network := provider.Network(opts.KindClusterName); network != "" {
+		genErr = errors.Join(genErr, git.DisconnectNetwork(ctx, network))
+	}
+
+	err = provider.Delete(ctx, opts.KindClusterName)
 	if err != nil {
 		genErr = errors.Join(genErr, err)
 	}
 
-	err = c.giteaClient.Delete(ctx, opts.GiteaContainerName)
+	err = git.Delete(ctx)
+	if err != nil {
+		genErr = errors.Join(genErr, err)
+	}
+
+	err = removeEnv(opts.KindClusterName)
+	if err != nil {
+		genErr = errors.Join(genErr, err)
+	}
+
+	err = removeSnapshots(opts.KindClusterName)
 	if err != nil {
 		genErr = errors.Join(genErr, err)
 	}
@@ -176,12 +437,34 @@ func (c *Client) Delete(ctx context.Context, opts DeleteOpts) error {
 	return genErr
 }
 
-func applyManifest(ctx context.Context, manifests ...string) error {
+// withRuntime returns a client which runs the containers with the runtime, so the environments created
+// with another runtime than the one of the client are removed with theirs. it shares the output, the
+// runner and the report of the client.
+func (c *Client) withRuntime(runtime container.Runtime) *Client {
+	if runtime == c.runtime {
+		return c
+	}
+
+	clone := *c
+	clone.runtime = runtime
+	clone.giteaClient = c.giteaClient.WithRuntime(runtime)
+	clone.providers = newProviders(runtime, c.runner, c.out)
+
+	return &clone
+}
+
+// newProviders returns the providers which create the clusters of containers, by name
+func newProviders(runtime container.Runtime, runner exec.Runner, out io.Writer) map[string]cluster.Provider {
+	return map[string]cluster.Provider{
+		"kind": kind.NewClient(runtime, runner, out),
+		"k3d":  k3d.NewClient(runtime, runner, out),
+	}
+}
+
+func (c *Client) applyManifest(ctx context.Context, kubeContext string, manifests ...string) error {
 
 	for _, manifest := range manifests {
-		cmd := fmt.Sprintf("kubectl apply -f %s", manifest)
-		buf := bytes.Buffer{}
-		err := exec.LocalExecContext(ctx, cmd, &buf)
+		_, err := c.runner.Run(ctx, exec.Command("kubectl", "--context", kubeContext, "apply", "-f", manifest))
 		if err != nil {
 			return err
 		}
@@ -189,120 +472,195 @@ func applyManifest(ctx context.Context, manifests ...string) error {
 
 	return nil
 }
+
+// StartEnv starts the git server and creates the cluster and bootstraps flux.
+// the returned func removes everything that was created, also when it fails.
 func (c *Client) StartEnv(ctx context.Context, opts CreateOpts) (func() error, error) {
+	rb := newRollback(c.out)
 
-	var cancelFuncs cancelFuncs
+	err := c.startEnv(ctx, opts, rb)
 
-	type res struct {
-		err        error
-		cancelFunc func() error
-	}
+	return rb.CancelFunc(), err
+}
 
-	resCh := make(chan res)
-	var wg sync.WaitGroup
-	done := make(chan struct{})
+func (c *Client) startEnv(ctx context.Context, opts CreateOpts, rb *rollback) error {
 
-	wg.Add(1)
-	go func(client *Client) {
-		defer wg.Done()
-		containerName, err := c.SetUpGitea(ctx, opts)
-		cancelFunc := func() error {
-			return nil
-		}
-		if err != nil {
-			cancelFunc = func() error { return c.giteaClient.Delete(context.TODO(), containerName) }
-		}
+	// The env is saved before anything is created, so gc finds what a crashed run left behind
+	env := newEnv(opts)
+	env.ContainerRuntime = c.runtime
+	err := saveEnv(env)
+	if err != nil {
+		return err
+	}
 
-		resCh <- res{
-			cancelFunc: cancelFunc,
-			err:        err,
-		}
+	rb.add(fmt.Sprintf("env %s", env.Name), func(ctx context.Context) error {
+		return removeEnv(env.Name)
+	})
 
-	}(c)
+	provider, err := c.clusterProvider(opts.ClusterProvider, opts.KubeContext)
+	if err != nil {
+		return err
+	}
 
-	wg.Add(1)
-	go func(client *Client) {
-		defer wg.Done()
-		cancelFunc, err := client.SetUpKind(ctx, opts)
-		resCh <- res{
-			cancelFunc: cancelFunc,
-			err:        err,
-		}
-	}(c)
+	errCh := make(chan error)
+
+	go func() {
+		errCh <- c.phase("setup", c.git.Name(), func() error {
+			return c.SetUpGitServer(ctx, opts, rb.add)
+		})
+	}()
 
-	// wait until
 	go func() {
-		wg.Wait()
-		close(resCh)
-		done <- struct{}{}
+		errCh <- c.phase("setup", provider.Name(), func() error {
+			return c.SetUpKind(ctx, opts, rb.add)
+		})
 	}()
 
-	// error from both gitea and kind
+	// Wait until the cluster and the git server are ready, and collect the errors from both
 	var genErr error
-	for i := range resCh {
-		cancelFuncs = append(cancelFuncs, i.cancelFunc)
-		if i.err != nil {
-			genErr = errors.Join(genErr, i.err)
-		}
+	for i := 0; i < 2; i++ {
+		genErr = errors.Join(genErr, <-errCh)
 	}
 
-	// Wait until kind and gitea are ready
-	<-done
-
 	if genErr != nil {
-		return cancelFuncs.CancelFunc(), genErr
+		return genErr
 	}
 
+	// The token is created with the git server
+	if c.git.Token() != "" {
+		c.redactor.Add(c.git.Token())
+		env.GiteaToken = c.git.Token()
+
+		err = saveEnv(env)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.env = &env
+
 	// Bootstrap
 
-	ip, err := getOutboundIP()
+	bootstrapOpts, err := newBootstrapOpts(opts, c.git)
+	if err != nil {
+		return err
+	}
+
+	c.fluxClient.UseContext(provider.KubeContext(opts.KindClusterName))
+	err = c.phase("setup", "bootstrap", func() error {
+		return c.fluxClient.Bootstrap(ctx, bootstrapOpts)
+	})
 	if err != nil {
-		return cancelFuncs.CancelFunc(), err
+		return fmt.Errorf("failed to bootstrap: %w", err)
 	}
 
-	repoName := path.Base(opts.FluxBootstrapRepo)
-	bootstrapOpts := flux.BootstrapOpts{
-		PrivateKeyPath: opts.PrivateKeyPath,
+	return c.setUpWebhooks(ctx, opts, provider, rb.add)
+}
+
+// newBootstrapOpts returns the options flux is bootstrapped with from the repo of the git server
+func newBootstrapOpts(opts CreateOpts, git gitServer) (flux.BootstrapOpts, error) {
+	url, err := git.BootstrapURL(path.Base(opts.FluxBootstrapRepo))
+	if err != nil {
+		return flux.BootstrapOpts{}, err
+	}
+
+	creds := git.Credentials()
+	return flux.BootstrapOpts{
+		PrivateKeyPath: creds.PrivateKeyPath,
 		Branch:         "main",
 		Path:           opts.FluxPath,
-		Password:       opts.GiteaPassword,
-		Username:       opts.GiteaUsername,
-		HttpPort:       opts.GiteaHttpPort,
-		Url:            fmt.Sprintf("localhost:%d/%s/%s.git", opts.GiteaSshPort, opts.GiteaUsername, repoName),
-		GitRepoUrl:     fmt.Sprintf("http://%s:%d/%s/%s.git", ip.String(), opts.GiteaHttpPort, opts.GiteaUsername, repoName),
+		Password:       creds.Password,
+		Username:       creds.Username,
+		Url:            url,
+		Repos:          clusterRepos(opts, git),
+	}, nil
+}
+
+// clusterRepos returns how the cluster clones the repos of the git server
+func clusterRepos(opts CreateOpts, git gitServer) flux.RepoOpts {
+	creds := git.ClusterCredentials()
+	repos := flux.RepoOpts{
+		URL:      git.ClusterURL,
+		Username: creds.Username,
+		Password: creds.Password,
 	}
 
-	err = c.fluxClient.Bootstrap(ctx, bootstrapOpts)
-	if err != nil {
-		return cancelFuncs.CancelFunc(), fmt.Errorf("failed to bootstrap: %w", err)
+	if !opts.SkipWebhooks {
+		repos.Receiver = receiverName
 	}
 
-	return cancelFuncs.CancelFunc(), nil
+	return repos
+}
+
+// receiverName is the flux receiver the webhooks of gitea call
+const receiverName = "gitea"
+
+// setUpWebhooks creates the flux receiver and adds a webhook which calls it to every repo, so the
+// GitRepositories are reconciled when the repos are pushed instead of on their interval.
+// gitea is connected to the network of the cluster to reach the receiver on a node port.
+func (c *Client) setUpWebhooks(ctx context.Context, opts CreateOpts, provider cluster.Provider, cleanup Cleanup) error {
+	network := provider.Network(opts.KindClusterName)
+	if opts.SkipWebhooks || network == "" {
+		return nil
+	}
+
+	return c.phase("setup", "webhooks", func() error {
+		webhookPath, err := c.fluxClient.CreateReceiver(ctx, receiverName)
+		if err != nil {
+			return err
+		}
+
+		addr, err := c.fluxClient.ExposeReceiver(ctx)
+		if err != nil {
+			return err
+		}
 
+		err = c.git.AddWebhooks(ctx, cleanup, network, addr+webhookPath)
+		if err != nil {
+			return fmt.Errorf("failed to add webhooks: %w", err)
+		}
+
+		fmt.Fprintf(c.out, "added webhooks of receiver %s \n", receiverName)
+
+		return nil
+	})
 }
 
-func (c *Client) SetUpKind(ctx context.Context, opts CreateOpts) (func() error, error) {
-	fmt.Fprintln(c.out, "creating kind cluster")
+// SetUpKind creates the cluster with the provider of the options, applies the manifests and loads the images.
+// the cluster is registered with cleanup as soon as it's created.
+func (c *Client) SetUpKind(ctx context.Context, opts CreateOpts, cleanup Cleanup) error {
+	provider, err := c.clusterProvider(opts.ClusterProvider, opts.KubeContext)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "creating %s cluster \n", provider.Name())
 
 	// Create cluster
-	err := c.kindClient.CreateClusterWithConfig(opts.KindClusterName, opts.KindConfigPath)
+	err = c.phase(provider.Name(), "create cluster", func() error {
+		return provider.Create(ctx, opts.KindClusterName, opts.KindConfigPath, opts.Labels)
+	})
 	if err != nil {
-		return func() error { return nil }, fmt.Errorf("failed to create kind cluster: %w", err)
+		return fmt.Errorf("failed to create %s cluster: %w", provider.Name(), err)
 	}
 
-	fmt.Fprintln(c.out, "kind cluster created")
+	cleanup(fmt.Sprintf("%s cluster %s", provider.Name(), opts.KindClusterName), func(ctx context.Context) error {
+		return provider.Delete(ctx, opts.KindClusterName)
+	})
 
-	cancelFunc := func() error {
-		return c.kindClient.DeleteCluster(opts.KindClusterName)
-	}
+	fmt.Fprintf(c.out, "%s cluster created \n", provider.Name())
 
 	if len(opts.ManifestsToApply) > 0 {
 		fmt.Fprintln(c.out, "applying manifests")
 	}
 
-	err = applyManifest(ctx, opts.ManifestsToApply...)
-	if err != nil {
-		return cancelFunc, fmt.Errorf("failed to apply manifests: %w", err)
+	if len(opts.ManifestsToApply) > 0 {
+		err = c.phase(provider.Name(), "apply manifests", func() error {
+			return c.applyManifest(ctx, provider.KubeContext(opts.KindClusterName), opts.ManifestsToApply...)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply manifests: %w", err)
+		}
 	}
 
 	if len(opts.ManifestsToApply) > 0 {
@@ -310,82 +668,73 @@ func (c *Client) SetUpKind(ctx context.Context, opts CreateOpts) (func() error,
 	}
 
 	if len(opts.KindImageToLoad) > 0 {
-		fmt.Fprintln(c.out, "loading images to kind cluster")
+		fmt.Fprintf(c.out, "loading images to %s cluster \n", provider.Name())
 	}
 
-	// load images
-	for _, image := range opts.KindImageToLoad {
-		var buf bytes.Buffer
-		cmd := fmt.Sprintf("kind load docker-image %s --name %s", image, opts.KindClusterName)
-		err := exec.LocalExecContext(ctx, cmd, &buf)
-		if err != nil {
-
-			// Ignore error when image not present on local host
-			if strings.Contains(buf.String(), "not present locally") {
-				fmt.Fprintf(c.out, "image %s is not present locally, will not load \n", image)
-				continue
-			}
-			return cancelFunc, fmt.Errorf("failed to load image %s: %s %w", image, buf.String(), err)
-		}
+	err = provider.LoadImages(ctx, cluster.LoadImagesOpts{
+		ClusterName: opts.KindClusterName,
+		Images:      removeDuplicate(opts.KindImageToLoad),
+		Pull:        opts.KindPullImages,
+		Phase: func(image string, load func() error) error {
+			return c.phase("images", image, load)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load images: %w", err)
 	}
 
 	if len(opts.KindImageToLoad) > 0 {
 		fmt.Fprintln(c.out, "loaded images")
 	}
 
-	fmt.Fprintln(c.out, "finish setting up kind cluster")
+	fmt.Fprintf(c.out, "finish setting up %s cluster \n", provider.Name())
 
-	return cancelFunc, nil
+	return nil
 }
 
-// TODO: do i need to delete the gitea container if the operation failed?
-func (c *Client) SetUpGitea(ctx context.Context, opts CreateOpts) (string, error) {
+// SetUpGitServer starts the git server of the options and uploads the local repos.
+// every resource is registered with cleanup as soon as it's created.
+func (c *Client) SetUpGitServer(ctx context.Context, opts CreateOpts, cleanup Cleanup) error {
 
-	signUpOpts := gitea.StartContainerOpts{
-		Email:         fmt.Sprintf("%s@gmail.com", opts.GiteaUsername),
-		Password:      opts.GiteaPassword,
-		Username:      opts.GiteaUsername,
-		ContainerName: opts.GiteaContainerName,
-	}
+	if c.git == nil {
+		git, err := c.newGitServer(opts.gitServerOpts())
+		if err != nil {
+			return err
+		}
 
-	// Start github
-	containerName, err := c.giteaClient.Start(ctx, signUpOpts)
-	if err != nil {
-		return containerName, fmt.Errorf("failed to start gitea: %w", err)
+		c.git = git
 	}
 
-	_, err = c.giteaClient.GeneratePrivatePublicKeys("test", opts.PrivateKeyPath)
+	err := c.git.Start(ctx, cleanup)
 	if err != nil {
-		return containerName, fmt.Errorf("failed to generate public and private keys: %w", err)
+		return err
 	}
 
 	errCh := make(chan error)
-	defer close(errCh)
 	for _, repoPath := range opts.GiteaLocalRepoPaths {
-		go func(clinet *Client, repoPath string) {
-
+		go func(repoPath string) {
 			repoName := path.Base(repoPath)
-			repoOpts := giteasdk.CreateRepoOption{
-				Name:       repoName,
-				TrustModel: giteasdk.TrustModelCollaboratorCommitter,
-			}
 
-			_, err = c.giteaClient.CreateRepoFromExisting(ctx, repoOpts, repoPath)
-			errCh <- err
-		}(c, repoPath)
+			errCh <- c.phase("repos", repoName, func() error {
+				return c.git.CreateRepo(ctx, cleanup, repoName, repoPath)
+			})
+		}(repoPath)
 
 	}
 
+	// Wait for all the uploads so no goroutine is left behind
+	var genErr error
 	for i := 0; i < len(opts.GiteaLocalRepoPaths); i++ {
-		err := <-errCh
-		if err != nil {
-			return containerName, fmt.Errorf("failed to create gitea repo with local repo files: %w", err)
-		}
+		genErr = errors.Join(genErr, <-errCh)
+	}
+
+	if genErr != nil {
+		return fmt.Errorf("failed to create %s repo with local repo files: %w", c.git.Name(), genErr)
 	}
 
-	fmt.Fprintln(c.out, "finish setting up gitea")
+	fmt.Fprintf(c.out, "finish setting up %s \n", c.git.Name())
 
-	return containerName, nil
+	return nil
 }
 
 // KsDeps return the kustomizations by order of deps
@@ -396,41 +745,157 @@ func (c *Client) KsDeps(ctx context.Context) ([]types.NamespacedName, error) {
 		return nil, err
 	}
 
-	deps := organizeKsByDeps(kss)
+	return organizeKsByDeps(kss)
+}
+
+// KsLevels returns the kustomizations grouped by their dependencies,
+// the kustomizations of a level depend only on the levels before it.
+func (c *Client) KsLevels(ctx context.Context) ([][]types.NamespacedName, error) {
+
+	kss, err := c.fluxClient.ListKs(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return deps, nil
+	return ksLevels(kss)
 }
 
-func organizeKsByDeps(kss []v1beta2.Kustomization) []types.NamespacedName {
-	deps := make(map[types.NamespacedName][]types.NamespacedName)
+// organizeKsByDeps returns the kustomizations of ksLevels one level after the other, so a
+// kustomization comes after its dependencies. Kustomizations of the same level are ordered
+// by namespace and then name, not by the order they were listed.
+func organizeKsByDeps(kss []v1beta2.Kustomization) ([]types.NamespacedName, error) {
+	levels, err := ksLevels(kss)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []types.NamespacedName
+	for _, level := range levels {
+		res = append(res, level...)
+	}
+
+	return res, nil
+}
+
+// ksLevels sorts the kustomizations topologically. Each level is sorted by namespace and name
+// so the order is stable, dependencies on kustomizations which don't exist are ignored.
+func ksLevels(kss []v1beta2.Kustomization) ([][]types.NamespacedName, error) {
+
+	// collect on which ks the our ks is depends on, and which ks depend on it
+	deps := make(map[types.NamespacedName]int)
+	dependents := make(map[types.NamespacedName][]types.NamespacedName)
+
+	for _, ks := range kss {
+		deps[types.NamespacedName{Namespace: ks.Namespace, Name: ks.Name}] = 0
+	}
 
-	// collect on which ks the our ks is depends on
 	for _, ks := range kss {
 		ksInfo := types.NamespacedName{
 			Namespace: ks.Namespace,
 			Name:      ks.Name,
 		}
-		for _, d := range ks.Spec.DependsOn {
 
-			deps[ksInfo] = append(deps[ksInfo], types.NamespacedName{
-				Namespace: ks.Namespace,
+		for _, d := range removeDuplicate(ks.Spec.DependsOn) {
+			dep := types.NamespacedName{
+				Namespace: d.Namespace,
 				Name:      d.Name,
-			})
+			}
+
+			// Without a namespace the dependency is in the namespace of the ks
+			if dep.Namespace == "" {
+				dep.Namespace = ks.Namespace
+			}
+
+			if _, ok := deps[dep]; !ok {
+				continue
+			}
+
+			deps[ksInfo]++
+			dependents[dep] = append(dependents[dep], ksInfo)
 		}
 	}
 
-	var res []types.NamespacedName
+	var level []types.NamespacedName
+	for ks, n := range deps {
+		if n == 0 {
+			level = append(level, ks)
+		}
+	}
+
+	var levels [][]types.NamespacedName
+	var sorted int
+	for len(level) > 0 {
+		sortNamespacedNames(level)
+		levels = append(levels, level)
+		sorted += len(level)
+
+		var next []types.NamespacedName
+		for _, ks := range level {
+			for _, dependent := range dependents[ks] {
+				deps[dependent]--
+				if deps[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+
+		level = next
+	}
+
+	if sorted != len(deps) {
+		cycle := ksCycle(deps, dependents)
+		return nil, fmt.Errorf("kustomizations have circular dependencies: %s", strings.Join(cycle, ", "))
+	}
+
+	return levels, nil
+}
+
+// ksCycle returns the kustomizations which are left unsorted by ksLevels and are on a cycle,
+// the ones which only depend on a cycle are dropped by removing the kustomizations nothing
+// unsorted depends on until none are left.
+func ksCycle(deps map[types.NamespacedName]int, dependents map[types.NamespacedName][]types.NamespacedName) []string {
+
+	unsorted := make(map[types.NamespacedName]bool)
+	for ks, n := range deps {
+		if n > 0 {
+			unsorted[ks] = true
+		}
+	}
 
-	// for each dependency of the kustomization get their dependencies
-	for k := range deps {
-		Dependencies(deps, &res, k)
-		res = append(res, k)
+	for removed := true; removed; {
+		removed = false
+		for ks := range unsorted {
+			var depended bool
+			for _, dependent := range dependents[ks] {
+				if unsorted[dependent] {
+					depended = true
+					break
+				}
+			}
+
+			if !depended {
+				delete(unsorted, ks)
+				removed = true
+			}
+		}
+	}
+
+	var cycle []string
+	for ks := range unsorted {
+		cycle = append(cycle, ks.String())
 	}
+	sort.Strings(cycle)
 
-	res = removeDuplicate(res)
+	return cycle
+}
 
-	fmt.Println(res)
-	return res
+func sortNamespacedNames(names []types.NamespacedName) {
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Namespace != names[j].Namespace {
+			return names[i].Namespace < names[j].Namespace
+		}
+		return names[i].Name < names[j].Name
+	})
 }
 
 func removeDuplicate[T comparable](sliceList []T) []T {
@@ -445,23 +910,76 @@ func removeDuplicate[T comparable](sliceList []T) []T {
 	return list
 }
 
-// Dependencies returns the order of the dependencies
-func Dependencies(deps map[types.NamespacedName][]types.NamespacedName, res *[]types.NamespacedName, ks types.NamespacedName) {
+func (c *Client) WaitForKs(ctx context.Context, kss ...types.NamespacedName) error {
+	return c.fluxClient.WaitForKs(ctx, kss...)
+}
 
-	// if there is no deps then we stop
-	if len(deps[ks]) == 0 {
-		return
+// waitForKs waits for each kustomization as a phase of the report, the failures
+// have the message of the ready condition of the kustomization.
+func (c *Client) waitForKs(ctx context.Context, kss ...types.NamespacedName) error {
+	errCh := make(chan error)
+	for _, ks := range kss {
+		go func(ks types.NamespacedName) {
+			errCh <- c.phase("wait", ks.String(), func() error {
+				err := c.fluxClient.WaitForKs(ctx, ks)
+				if err != nil {
+					return c.ksFailure(ctx, ks, err)
+				}
+				return nil
+			})
+		}(ks)
 	}
 
-	ksDeps := deps[ks]
+	var genErr error
+	for i := 0; i < len(kss); i++ {
+		genErr = errors.Join(genErr, <-errCh)
+	}
 
-	for _, k := range ksDeps {
-		Dependencies(deps, res, k)
-		*res = append(*res, k)
+	return genErr
+}
+
+// ksFailure adds the message of the ready condition of the kustomization to the error
+func (c *Client) ksFailure(ctx context.Context, ks types.NamespacedName, err error) error {
+	kustomization, getErr := c.fluxClient.GetKs(ctx, ks)
+	if getErr != nil {
+		return err
+	}
+
+	cond := meta.FindStatusCondition(kustomization.Status.Conditions, apimeta.ReadyCondition)
+	if cond == nil || cond.Message == "" {
+		return err
 	}
 
+	return fmt.Errorf("%w: %s", err, cond.Message)
 }
 
-func (c *Client) WaitForKs(ctx context.Context, kss ...types.NamespacedName) error {
-	return c.fluxClient.WaitForKs(ctx, kss...)
+// clusterProvider returns the provider by its name, kind when the name is empty.
+// the existing provider uses the cluster of the kube context.
+func (c *Client) clusterProvider(name string, kubeContext string) (cluster.Provider, error) {
+	if name == "" {
+		name = "kind"
+	}
+
+	if name == "existing" {
+		return existing.NewClient(kubeContext, c.out), nil
+	}
+
+	provider, ok := c.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster provider %q, use kind, k3d or existing", name)
+	}
+
+	return provider, nil
+}
+
+// Report returns the phases of the runs of the client, with their durations and failures
+func (c *Client) Report() *report.Report {
+	return c.report
+}
+
+// phase runs fn as a phase of the report, the failure is redacted
+func (c *Client) phase(suite, name string, fn func() error) error {
+	return c.report.Phase(suite, name, func() error {
+		return c.redactor.Error(fn())
+	})
 }
@@ -1,8 +1,13 @@
 package integration
 
 import (
+	"context"
+	"io"
 	"testing"
 
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/ezratameno/integration/pkg/gitea"
 	"github.com/fluxcd/kustomize-controller/api/v1beta2"
 	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/stretchr/testify/require"
@@ -84,6 +89,8 @@ func TestOrganizeKsByDeps(t *testing.T) {
 		},
 	})
 
+	// apps and infra-users both depend only on infra-habana, so they are on the same level
+	// and ordered by name
 	expected := []types.NamespacedName{
 		{
 			Name:      "infra-controllers",
@@ -98,15 +105,58 @@ func TestOrganizeKsByDeps(t *testing.T) {
 			Namespace: "flux-system",
 		},
 		{
-			Name:      "infra-users",
+			Name:      "apps",
 			Namespace: "flux-system",
 		},
 		{
-			Name:      "apps",
+			Name:      "infra-users",
 			Namespace: "flux-system",
 		},
 	}
-	res := organizeKsByDeps(kss)
+	res, err := organizeKsByDeps(kss)
+	require.NoError(t, err)
 	require.Equal(t, expected, res)
 
+	// the kustomizations of a level are ordered by namespace and then name, whatever the order they are listed in
+	level := []v1beta2.Kustomization{
+		{ObjectMeta: v1.ObjectMeta{Name: "infra-configs", Namespace: "flux-system"}},
+		{ObjectMeta: v1.ObjectMeta{Name: "monitoring", Namespace: "apps"}},
+		{ObjectMeta: v1.ObjectMeta{Name: "apps", Namespace: "flux-system"}},
+		{ObjectMeta: v1.ObjectMeta{Name: "cert-manager", Namespace: "apps"}},
+	}
+	res, err = organizeKsByDeps(level)
+	require.NoError(t, err)
+	require.Equal(t, []types.NamespacedName{
+		{Name: "cert-manager", Namespace: "apps"},
+		{Name: "monitoring", Namespace: "apps"},
+		{Name: "apps", Namespace: "flux-system"},
+		{Name: "infra-configs", Namespace: "flux-system"},
+	}, res)
+
+	// infra-controllers depends on apps which depends on it, infra-users only depends on the cycle
+	kss[2].Spec.DependsOn = []meta.NamespacedObjectReference{
+		{
+			Name: "apps",
+		},
+	}
+	_, err = organizeKsByDeps(kss)
+	require.EqualError(t, err, "kustomizations have circular dependencies: "+
+		"flux-system/apps, flux-system/infra-configs, flux-system/infra-controllers, flux-system/infra-habana")
+
+}
+
+func TestWithRuntime(t *testing.T) {
+	runner := exec.NewFakeRunner()
+
+	c, err := NewClient(gitea.Opts{Runtime: container.Docker}, runner, io.Discard)
+	require.NoError(t, err)
+	require.Same(t, c, c.withRuntime(container.Docker))
+
+	podman := c.withRuntime(container.Podman)
+
+	_, err = podman.giteaClient.ContainerExists(context.Background(), "gitea")
+	require.NoError(t, err)
+
+	require.Equal(t, container.Docker, c.runtime)
+	require.Equal(t, []string{"podman container inspect gitea"}, runner.Commands())
 }
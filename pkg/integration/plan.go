@@ -0,0 +1,220 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/ezratameno/integration/pkg/flux"
+	"github.com/ezratameno/integration/pkg/gitea"
+	"github.com/ezratameno/integration/pkg/kind"
+)
+
+// Plan describes what Run would create, it's made without starting any container
+type Plan struct {
+	Env string `json:"env"`
+
+	// Preflight holds the failed preflight checks
+	Preflight string `json:"preflight,omitempty"`
+
+	ClusterProvider string `json:"clusterProvider"`
+	GitServer       string `json:"gitServer"`
+	KindClusterName string `json:"kindClusterName"`
+
+	// KindConfig is the config the cluster is created with, for kind it includes the defaults
+	KindConfig         string `json:"kindConfig"`
+	GiteaContainerName string `json:"giteaContainerName,omitempty"`
+	GiteaImage         string `json:"giteaImage,omitempty"`
+	GitURL             string `json:"gitUrl"`
+	GiteaUsername      string `json:"giteaUsername"`
+
+	Repos     []RepoPlan    `json:"repos"`
+	Bootstrap BootstrapPlan `json:"bootstrap"`
+	Images    []ImagePlan   `json:"images,omitempty"`
+	Manifests []string      `json:"manifests,omitempty"`
+
+	// KustomizationLevels is the order the kustomizations found in the flux path are reconciled by
+	KustomizationLevels [][]string `json:"kustomizationLevels,omitempty"`
+	HelmReleases        []string   `json:"helmReleases,omitempty"`
+	GitRepositories     []string   `json:"gitRepositories,omitempty"`
+
+	// MissingRepos are the urls of GitRepositories which are not in the local repos
+	MissingRepos []string `json:"missingRepos,omitempty"`
+
+	// Problems are references between the flux objects which are broken
+	Problems     []string `json:"problems,omitempty"`
+	WaitFor      []string `json:"waitFor,omitempty"`
+	WaitForAll   bool     `json:"waitForAll,omitempty"`
+	SnapshotName string   `json:"snapshotName,omitempty"`
+}
+
+type RepoPlan struct {
+	Name      string   `json:"name"`
+	LocalPath string   `json:"localPath"`
+	Files     []string `json:"files"`
+}
+
+type BootstrapPlan struct {
+	URL        string `json:"url"`
+	Branch     string `json:"branch"`
+	Path       string `json:"path"`
+	Username   string `json:"username"`
+	GitRepoURL string `json:"gitRepoUrl"`
+
+	// Receiver is the flux receiver the webhooks of the repos call, empty without webhooks
+	Receiver string `json:"receiver,omitempty"`
+}
+
+type ImagePlan struct {
+	Image   string `json:"image"`
+	Archive bool   `json:"archive"`
+}
+
+// Plan validates the options, runs the preflight checks and describes what Run would create.
+// a failure of the preflight checks is returned with the plan.
+func (c *Client) Plan(ctx context.Context, opts CreateOpts) (*Plan, error) {
+	c.redactor.Add(opts.GiteaPassword, opts.PrivateKeyPath)
+
+	err := validateCreateOpts(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	git, err := c.newGitServer(opts.gitServerOpts())
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Env:             opts.KindClusterName,
+		ClusterProvider: opts.ClusterProvider,
+		GitServer:       git.Name(),
+		KindClusterName: opts.KindClusterName,
+		GitURL:          git.URL(),
+		GiteaUsername:   opts.GiteaUsername,
+		Manifests:       opts.ManifestsToApply,
+		SnapshotName:    opts.SnapshotName,
+		WaitForAll:      opts.WaitForAll,
+	}
+
+	if git.Name() == GitServerGitea {
+		plan.GiteaContainerName = opts.GiteaContainerName
+		plan.GiteaImage = opts.GiteaContainer.ImageRef()
+	}
+
+	switch {
+	case opts.ClusterProvider == "kind":
+		kindConfig, err := kind.RenderConfig(opts.KindClusterName, opts.KindConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		plan.KindConfig = string(kindConfig)
+
+	case opts.KindConfigPath != "":
+		config, err := os.ReadFile(opts.KindConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s config: %w", opts.ClusterProvider, err)
+		}
+		plan.KindConfig = string(config)
+	}
+
+	for _, repoPath := range opts.GiteaLocalRepoPaths {
+		files, err := gitea.LocalFiles(repoPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read local repo %s: %w", repoPath, err)
+		}
+
+		plan.Repos = append(plan.Repos, RepoPlan{
+			Name:      path.Base(repoPath),
+			LocalPath: repoPath,
+			Files:     files,
+		})
+	}
+
+	bootstrapOpts, err := newBootstrapOpts(opts, git)
+	if err != nil {
+		return nil, err
+	}
+
+	gitRepoURL, err := bootstrapOpts.Repos.URL(path.Base(opts.FluxBootstrapRepo))
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Bootstrap = BootstrapPlan{
+		URL:        bootstrapOpts.Url,
+		Branch:     bootstrapOpts.Branch,
+		Path:       bootstrapOpts.Path,
+		Username:   bootstrapOpts.Username,
+		GitRepoURL: gitRepoURL,
+		Receiver:   bootstrapOpts.Repos.Receiver,
+	}
+
+	for _, image := range opts.KindImageToLoad {
+		plan.Images = append(plan.Images, ImagePlan{
+			Image:   image,
+			Archive: filepath.Ext(image) == ".tar",
+		})
+	}
+
+	fluxRepo, err := parseFluxRepo(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hr := range fluxRepo.HelmReleases {
+		plan.HelmReleases = append(plan.HelmReleases, fmt.Sprintf("%s/%s", hr.Namespace, hr.Name))
+	}
+
+	for _, gitRepo := range fluxRepo.GitRepositories {
+		plan.GitRepositories = append(plan.GitRepositories, fmt.Sprintf("%s/%s %s", gitRepo.Namespace, gitRepo.Name, gitRepo.Spec.URL))
+	}
+
+	plan.MissingRepos = fluxRepo.MissingRepos
+	plan.Problems = fluxRepo.Problems
+
+	levels, err := ksLevels(fluxRepo.Kustomizations)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, level := range levels {
+		var names []string
+		for _, ks := range level {
+			names = append(names, ks.String())
+		}
+		plan.KustomizationLevels = append(plan.KustomizationLevels, names)
+	}
+
+	for _, ks := range opts.KustomizationsToWaitFor {
+		plan.WaitFor = append(plan.WaitFor, ks.String())
+	}
+
+	if opts.SkipPreflight {
+		return plan, nil
+	}
+
+	err = c.Preflight(ctx, opts)
+	if err != nil {
+		plan.Preflight = c.redactor.String(err.Error())
+		return plan, c.redactor.Error(err)
+	}
+
+	return plan, nil
+}
+
+// parseFluxRepo discovers the flux objects of the bootstrap path in the local repos
+func parseFluxRepo(opts CreateOpts) (*flux.Repo, error) {
+	repo, err := flux.ParseRepo(flux.ParseRepoOpts{
+		RepoPath:   opts.FluxBootstrapRepo,
+		Path:       opts.FluxPath,
+		LocalRepos: opts.GiteaLocalRepoPaths,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse flux objects of %s: %w", filepath.Join(opts.FluxBootstrapRepo, opts.FluxPath), err)
+	}
+
+	return repo, nil
+}
@@ -0,0 +1,367 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"syscall"
+
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/ezratameno/integration/pkg/existing"
+	"github.com/hashicorp/go-version"
+)
+
+// minFreeDiskSpace is the minimum free space we need for the kind node images and the image archives
+const minFreeDiskSpace = 5 << 30
+
+// minBinaryVersions are the binaries we shell out to and the minimum version we support
+var minBinaryVersions = map[string]struct {
+	args       []string
+	minVersion string
+}{
+	"docker":  {args: []string{"version", "--format", "{{.Client.Version}}"}, minVersion: "20.10.0"},
+	"kubectl": {args: []string{"version", "--client"}, minVersion: "1.24.0"},
+	"podman":  {args: []string{"version", "--format", "{{.Client.Version}}"}, minVersion: "4.0.0"},
+	"flux":    {args: []string{"version", "--client"}, minVersion: "2.1.0"},
+	"k3d":     {args: []string{"version"}, minVersion: "5.0.0"},
+	"git":     {args: []string{"version"}, minVersion: "2.18.0"},
+}
+
+// MinVersion returns the minimum version we support of a binary we shell out to
+func MinVersion(binary string) string {
+	return minBinaryVersions[binary].minVersion
+}
+
+var versionRegex = regexp.MustCompile(`v?(\d+\.\d+\.\d+)`)
+
+type preflightCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Preflight validates the options and checks that the environment can be created on this host.
+// All the problems found are reported together.
+func (c *Client) Preflight(ctx context.Context, opts CreateOpts) error {
+	c.redactor.Add(opts.GiteaPassword, opts.PrivateKeyPath)
+
+	err := validateCreateOpts(&opts)
+	if err != nil {
+		return errors.Join(fmt.Errorf("invalid options: %w", err), c.preflight(ctx, opts, false))
+	}
+
+	provider, err := c.clusterProvider(opts.ClusterProvider, opts.KubeContext)
+	if err != nil {
+		return err
+	}
+
+	git, err := c.newGitServer(opts.gitServerOpts())
+	if err != nil {
+		return err
+	}
+
+	var adopt bool
+	if opts.Reuse {
+		adopt, err = c.envExists(ctx, provider, git, opts.KindClusterName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.preflight(ctx, opts, adopt)
+}
+
+// preflight runs the checks, when adopting an existing environment the checks of the
+// ports and the names are skipped since the environment is using them.
+func (c *Client) preflight(ctx context.Context, opts CreateOpts, adopt bool) error {
+
+	fmt.Fprintln(c.out, "running preflight checks")
+
+	var genErr error
+	for _, check := range c.preflightChecks(opts, adopt) {
+		err := check.run(ctx)
+		if err != nil {
+			fmt.Fprintf(c.out, "preflight check %s failed: %s \n", check.name, err)
+			genErr = errors.Join(genErr, fmt.Errorf("%s: %w", check.name, err))
+			continue
+		}
+
+		fmt.Fprintf(c.out, "preflight check %s passed \n", check.name)
+	}
+
+	if genErr != nil {
+		return fmt.Errorf("preflight checks failed: %w", genErr)
+	}
+
+	return nil
+}
+
+func (c *Client) preflightChecks(opts CreateOpts, adopt bool) []preflightCheck {
+
+	var checks []preflightCheck
+
+	binaries := []string{c.runtime.Binary(), "kubectl", "flux"}
+
+	// kind is used as a library
+	if opts.ClusterProvider == "k3d" {
+		binaries = append(binaries, "k3d")
+	}
+
+	// The local git server runs git http-backend
+	if opts.GitServer == GitServerLocal {
+		binaries = append(binaries, "git")
+	}
+
+	for _, binary := range binaries {
+		binary := binary
+		checks = append(checks, preflightCheck{
+			name: fmt.Sprintf("%s binary", binary),
+			run: func(ctx context.Context) error {
+				return c.checkBinary(ctx, binary)
+			},
+		})
+	}
+
+	checks = append(checks, preflightCheck{
+		name: fmt.Sprintf("%s runtime", c.runtime.Binary()),
+		run:  c.checkContainerRuntime,
+	})
+
+	// The gitea container is run with the engine api, podman serves it only when its socket is enabled
+	if opts.GitServer != GitServerLocal {
+		checks = append(checks, preflightCheck{
+			name: fmt.Sprintf("%s api", c.runtime.Binary()),
+			run:  c.runtime.Ping,
+		})
+	}
+
+	if !adopt {
+		ports := []int{opts.GiteaHttpPort, opts.GiteaSshPort}
+
+		// The local git server serves only http
+		if opts.GitServer == GitServerLocal {
+			ports = ports[:1]
+		}
+
+		for _, port := range ports {
+			port := port
+			checks = append(checks, preflightCheck{
+				name: fmt.Sprintf("port %d", port),
+				run: func(ctx context.Context) error {
+					return checkPortAvailable(port)
+				},
+			})
+		}
+
+		git, err := c.newGitServer(opts.gitServerOpts())
+		if err == nil {
+			checks = append(checks, preflightCheck{
+				name: git.String(),
+				run: func(ctx context.Context) error {
+					exists, err := git.Exists(ctx)
+					if err != nil {
+						return err
+					}
+
+					if exists {
+						return fmt.Errorf("already exists")
+					}
+
+					return nil
+				},
+			})
+		}
+	}
+
+	switch {
+	// The existing cluster has to be reachable, also when it's adopted
+	case opts.ClusterProvider == "existing":
+		checks = append(checks, preflightCheck{
+			name: fmt.Sprintf("kube context %s", opts.KubeContext),
+			run: func(ctx context.Context) error {
+				_, err := existing.NewClient(opts.KubeContext, c.out).Validate(ctx)
+				return err
+			},
+		})
+
+	case !adopt:
+		checks = append(checks, preflightCheck{
+			name: fmt.Sprintf("cluster %s", opts.KindClusterName),
+			run: func(ctx context.Context) error {
+				provider, err := c.clusterProvider(opts.ClusterProvider, opts.KubeContext)
+				if err != nil {
+					return err
+				}
+
+				exists, err := provider.Exists(ctx, opts.KindClusterName)
+				if err != nil {
+					return err
+				}
+
+				if exists {
+					return fmt.Errorf("cluster already exists")
+				}
+
+				return nil
+			},
+		})
+	}
+
+	checks = append(checks, preflightCheck{
+		name: "disk space",
+		run: func(ctx context.Context) error {
+			return checkDiskSpace(os.TempDir(), minFreeDiskSpace)
+		},
+	})
+
+	for _, repoPath := range opts.GiteaLocalRepoPaths {
+		repoPath := repoPath
+		checks = append(checks, preflightCheck{
+			name: fmt.Sprintf("local repo %s", repoPath),
+			run: func(ctx context.Context) error {
+				return checkGitRepo(repoPath)
+			},
+		})
+	}
+
+	if opts.FluxBootstrapRepo != "" {
+		checks = append(checks, preflightCheck{
+			name: "flux objects",
+			run: func(ctx context.Context) error {
+				return checkFluxRepo(opts)
+			},
+		})
+	}
+
+	if opts.KindConfigPath != "" {
+		checks = append(checks, preflightCheck{
+			name: fmt.Sprintf("%s config", opts.ClusterProvider),
+			run: func(ctx context.Context) error {
+				_, err := os.Stat(opts.KindConfigPath)
+				return err
+			},
+		})
+	}
+
+	return checks
+}
+
+// checkFluxRepo checks that the flux objects of the bootstrap path reference objects which exist,
+// and that their GitRepositories are local repos which are pushed to gitea.
+func checkFluxRepo(opts CreateOpts) error {
+	repo, err := parseFluxRepo(opts)
+	if err != nil {
+		return err
+	}
+
+	var genErr error
+	for _, url := range repo.MissingRepos {
+		genErr = errors.Join(genErr, fmt.Errorf("GitRepository %s is not in the local repos", url))
+	}
+
+	for _, problem := range repo.Problems {
+		genErr = errors.Join(genErr, errors.New(problem))
+	}
+
+	_, err = ksLevels(repo.Kustomizations)
+
+	return errors.Join(genErr, err)
+}
+
+// checkBinary checks that the binary is in the PATH and that its version is supported
+func (c *Client) checkBinary(ctx context.Context, binary string) error {
+
+	_, err := osexec.LookPath(binary)
+	if err != nil {
+		return fmt.Errorf("not found in PATH")
+	}
+
+	v, ok := minBinaryVersions[binary]
+	if !ok {
+		return nil
+	}
+
+	res, err := c.runner.Run(ctx, exec.Command(binary, v.args...))
+	if err != nil {
+		return fmt.Errorf("failed to get version: %w", err)
+	}
+
+	current, err := parseVersion(res.Output())
+	if err != nil {
+		return err
+	}
+
+	minVersion := version.Must(version.NewVersion(v.minVersion))
+	if current.LessThan(minVersion) {
+		return fmt.Errorf("version %s is lower than the minimum supported version %s", current, minVersion)
+	}
+
+	return nil
+}
+
+// parseVersion finds the first semantic version in the output of a version command
+func parseVersion(output string) (*version.Version, error) {
+
+	match := versionRegex.FindStringSubmatch(output)
+	if len(match) < 2 {
+		return nil, fmt.Errorf("failed to find version in %q", output)
+	}
+
+	return version.NewVersion(match[1])
+}
+
+// checkContainerRuntime checks that the runtime can run containers, for docker that its daemon is reachable
+func (c *Client) checkContainerRuntime(ctx context.Context) error {
+	_, err := c.runner.Run(ctx, c.runtime.InfoCommand())
+	if err != nil {
+		return fmt.Errorf("%s is not reachable: %w", c.runtime.Binary(), err)
+	}
+
+	return nil
+}
+
+func checkPortAvailable(port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("port is not available: %w", err)
+	}
+
+	return l.Close()
+}
+
+func checkDiskSpace(dir string, minFree uint64) error {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return fmt.Errorf("failed to get disk usage of %s: %w", dir, err)
+	}
+
+	free := stat.Bavail * uint64(stat.Bsize)
+	if free < minFree {
+		return fmt.Errorf("only %d MiB free in %s, need at least %d MiB", free>>20, dir, minFree>>20)
+	}
+
+	return nil
+}
+
+func checkGitRepo(repoPath string) error {
+	info, err := os.Stat(repoPath)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+
+	_, err = os.Stat(filepath.Join(repoPath, ".git"))
+	if err != nil {
+		return fmt.Errorf("not a git repo")
+	}
+
+	return nil
+}
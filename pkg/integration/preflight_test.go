@@ -0,0 +1,25 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+
+	tests := map[string]string{
+		"flux: v2.2.3\n": "2.2.3",
+		"Client Version: v1.29.2\nKustomize Version: v5.0.4-0.20230601165947-6ce0bf390ce3\n": "1.29.2",
+		"24.0.7\n": "24.0.7",
+	}
+
+	for output, expected := range tests {
+		v, err := parseVersion(output)
+		require.NoError(t, err)
+		require.Equal(t, expected, v.String())
+	}
+
+	_, err := parseVersion("command not found")
+	require.Error(t, err)
+}
@@ -0,0 +1,232 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/report"
+	apimeta "github.com/fluxcd/pkg/apis/meta"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// StatusSkipped is the status of a kustomization which was not reconciled since a dependency failed
+const StatusSkipped = "skipped"
+
+type ReconcileOpts struct {
+	// Push the local repos to gitea and fetch the sources before reconciling
+	Push bool
+
+	// Kustomizations to reconcile, all of them when empty
+	Kustomizations []types.NamespacedName
+
+	// Timeout of the reconciliation of each kustomization, defaults to 5 minutes
+	Timeout time.Duration
+}
+
+// ReconcileResult is the result of the reconciliation of a kustomization
+type ReconcileResult struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// Level in the dependency graph, the kustomizations of a level are reconciled together
+	Level    int    `json:"level"`
+	Status   string `json:"status"`
+	Revision string `json:"revision,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Reconcile reconciles the kustomizations by the order of their dependencies, each level
+// of the graph is reconciled and waited for before the next one. once a level fails the
+// kustomizations of the next levels are skipped.
+func (c *Client) Reconcile(ctx context.Context, opts ReconcileOpts) ([]ReconcileResult, error) {
+	if c.env == nil {
+		return nil, fmt.Errorf("no environment, create or attach to one first")
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+
+	if opts.Push {
+		fmt.Fprintln(c.out, "pushing local repos to gitea")
+
+		err := c.syncRepos(ctx, c.env.GiteaLocalRepoPaths)
+		if err != nil {
+			return nil, c.redactor.Error(err)
+		}
+	}
+
+	levels, err := c.KsLevels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to order kustomizations by deps: %w", err)
+	}
+
+	levels, err = selectKs(levels, opts.Kustomizations)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ReconcileResult
+	var genErr error
+	for i, level := range levels {
+
+		if genErr != nil {
+			for _, ks := range level {
+				results = append(results, ReconcileResult{
+					Namespace: ks.Namespace,
+					Name:      ks.Name,
+					Level:     i,
+					Status:    StatusSkipped,
+				})
+
+				c.report.Add(report.Case{
+					Suite:     "reconcile",
+					Name:      ks.String(),
+					StartedAt: time.Now(),
+					Skipped:   true,
+				})
+			}
+			continue
+		}
+
+		fmt.Fprintf(c.out, "reconciling level %d: %v \n", i, level)
+
+		levelResults := c.reconcileLevel(ctx, level, opts)
+		for _, res := range levelResults {
+			res.Level = i
+			results = append(results, res)
+
+			if res.Status == StatusFailed {
+				genErr = errors.Join(genErr, fmt.Errorf("ks %s in namespace %s: %s", res.Name, res.Namespace, res.Error))
+			}
+		}
+	}
+
+	if genErr != nil {
+		return results, c.redactor.Error(fmt.Errorf("failed to reconcile kustomizations: %w", genErr))
+	}
+
+	return results, nil
+}
+
+// reconcileLevel reconciles the kustomizations of a level in parallel and waits for them to be ready
+func (c *Client) reconcileLevel(ctx context.Context, level []types.NamespacedName, opts ReconcileOpts) []ReconcileResult {
+
+	resCh := make(chan ReconcileResult)
+	for _, ks := range level {
+		go func(ks types.NamespacedName) {
+			resCh <- c.reconcileOne(ctx, ks, opts)
+		}(ks)
+	}
+
+	results := make(map[types.NamespacedName]ReconcileResult)
+	for i := 0; i < len(level); i++ {
+		res := <-resCh
+		results[types.NamespacedName{Namespace: res.Namespace, Name: res.Name}] = res
+	}
+
+	// Keep the order of the level
+	var ordered []ReconcileResult
+	for _, ks := range level {
+		ordered = append(ordered, results[ks])
+	}
+
+	return ordered
+}
+
+func (c *Client) reconcileOne(ctx context.Context, ks types.NamespacedName, opts ReconcileOpts) ReconcileResult {
+	res := ReconcileResult{
+		Namespace: ks.Namespace,
+		Name:      ks.Name,
+		Status:    StatusReady,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	var err error
+	if opts.Push {
+		err = c.fluxClient.ReconcileKSWithSource(ctx, ks)
+	} else {
+		err = c.fluxClient.ReconcileKS(ctx, ks)
+	}
+
+	if err == nil {
+		err = c.fluxClient.WaitForKs(ctx, ks)
+	}
+
+	duration := time.Since(start)
+	res.Duration = duration.Round(time.Second).String()
+
+	kustomization, getErr := c.fluxClient.GetKs(context.WithoutCancel(ctx), ks)
+	if getErr == nil {
+		res.Revision = kustomization.Status.LastAppliedRevision
+	}
+
+	if err != nil {
+		res.Status = StatusFailed
+		res.Error = err.Error()
+
+		// The condition explains why the reconciliation failed better than the timeout
+		cond := meta.FindStatusCondition(kustomization.Status.Conditions, apimeta.ReadyCondition)
+		if getErr == nil && cond != nil && cond.Status != metav1.ConditionTrue && cond.Message != "" {
+			res.Error = cond.Message
+		}
+	}
+
+	c.report.Add(report.Case{
+		Suite:     "reconcile",
+		Name:      ks.String(),
+		StartedAt: start,
+		Duration:  duration,
+		Failure:   c.redactor.String(res.Error),
+	})
+
+	return res
+}
+
+// selectKs keeps only the selected kustomizations in the levels, the empty levels are removed
+func selectKs(levels [][]types.NamespacedName, selected []types.NamespacedName) ([][]types.NamespacedName, error) {
+	if len(selected) == 0 {
+		return levels, nil
+	}
+
+	want := make(map[types.NamespacedName]bool)
+	for _, ks := range selected {
+		want[ks] = true
+	}
+
+	var res [][]types.NamespacedName
+	for _, level := range levels {
+		var kept []types.NamespacedName
+		for _, ks := range level {
+			if want[ks] {
+				kept = append(kept, ks)
+				delete(want, ks)
+			}
+		}
+
+		if len(kept) > 0 {
+			res = append(res, kept)
+		}
+	}
+
+	if len(want) > 0 {
+		var missing []types.NamespacedName
+		for ks := range want {
+			missing = append(missing, ks)
+		}
+		sortNamespacedNames(missing)
+
+		return nil, fmt.Errorf("kustomizations not found: %v", missing)
+	}
+
+	return res, nil
+}
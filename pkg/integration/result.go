@@ -0,0 +1,319 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	apimeta "github.com/fluxcd/pkg/apis/meta"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+const (
+	StatusReady    = "ready"
+	StatusNotReady = "notReady"
+	StatusFailed   = "failed"
+	StatusDeleted  = "deleted"
+	StatusMissing  = "missing"
+)
+
+// Result describes an environment, it's the document the cli prints with -o json|yaml
+type Result struct {
+	Env         string `json:"env"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	Kubeconfig  string `json:"kubeconfig,omitempty"`
+	KubeContext string `json:"kubeContext,omitempty"`
+
+	ClusterProvider    string `json:"clusterProvider,omitempty"`
+	GitServer          string `json:"gitServer,omitempty"`
+	KindClusterName    string `json:"kindClusterName,omitempty"`
+	GiteaContainerName string `json:"giteaContainerName,omitempty"`
+
+	Git            *GitServerResult      `json:"git,omitempty"`
+	Repos          []RepoResult          `json:"repos,omitempty"`
+	Kustomizations []KustomizationResult `json:"kustomizations,omitempty"`
+
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Duration   string     `json:"duration,omitempty"`
+
+	// Phases of the run with their timings, like creating the cluster or loading an image
+	Phases []PhaseResult `json:"phases,omitempty"`
+}
+
+// GitServerResult describes the git server of either kind, the ssh url and the private key are only of gitea
+type GitServerResult struct {
+	URL      string `json:"url"`
+	SSHURL   string `json:"sshUrl,omitempty"`
+	Username string `json:"username"`
+
+	// CredentialsFile holds the password of the user
+	CredentialsFile string `json:"credentialsFile"`
+	PrivateKeyPath  string `json:"privateKeyPath,omitempty"`
+}
+
+type RepoResult struct {
+	Name      string `json:"name"`
+	LocalPath string `json:"localPath"`
+	URL       string `json:"url"`
+	CloneURL  string `json:"cloneUrl"`
+
+	// DeployKeyPath is the private key that can clone the repo over ssh
+	DeployKeyPath string `json:"deployKeyPath,omitempty"`
+}
+
+type PhaseResult struct {
+	Suite     string    `json:"suite"`
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"startedAt"`
+	Duration  string    `json:"duration"`
+	Seconds   float64   `json:"seconds"`
+	Status    string    `json:"status"`
+}
+
+type KustomizationResult struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Ready     bool   `json:"ready"`
+	Revision  string `json:"revision,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Result returns the description of the environment the client works with, the kustomizations
+// are read from the cluster. the environment is ready when all its kustomizations are.
+func (c *Client) Result(ctx context.Context) (*Result, error) {
+	if c.env == nil {
+		return nil, fmt.Errorf("no environment, create or attach to one first")
+	}
+
+	env := c.env
+
+	provider, err := c.clusterProvider(env.ClusterProvider, env.KubeContext)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialsFile, err := envPath(env.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{
+		Env:             env.Name,
+		Kubeconfig:      kubeconfigPath(),
+		KubeContext:     provider.KubeContext(env.KindClusterName),
+		ClusterProvider: provider.Name(),
+		GitServer:       c.git.Name(),
+		KindClusterName: env.KindClusterName,
+		Git: &GitServerResult{
+			URL:             c.git.URL(),
+			Username:        env.GiteaUsername,
+			CredentialsFile: credentialsFile,
+			PrivateKeyPath:  c.git.Credentials().PrivateKeyPath,
+		},
+	}
+
+	if c.git.Name() == GitServerGitea {
+		res.GiteaContainerName = env.GiteaContainerName
+		res.Git.SSHURL = fmt.Sprintf("ssh://git@localhost:%d", env.GiteaSshPort)
+	}
+
+	for _, repoPath := range env.GiteaLocalRepoPaths {
+		repoName := path.Base(repoPath)
+		res.Repos = append(res.Repos, RepoResult{
+			Name:          repoName,
+			LocalPath:     repoPath,
+			URL:           c.git.RepoURL(repoName),
+			CloneURL:      c.git.CloneURL(repoName),
+			DeployKeyPath: c.git.DeployKeyPath(repoName),
+		})
+	}
+
+	kss, err := c.fluxClient.ListKs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kustomizations: %w", err)
+	}
+
+	for _, ks := range kss {
+		ksRes := KustomizationResult{
+			Namespace: ks.Namespace,
+			Name:      ks.Name,
+			Ready:     meta.IsStatusConditionTrue(ks.Status.Conditions, apimeta.ReadyCondition),
+			Revision:  ks.Status.LastAppliedRevision,
+		}
+
+		cond := meta.FindStatusCondition(ks.Status.Conditions, apimeta.ReadyCondition)
+		if cond != nil && !ksRes.Ready {
+			ksRes.Message = cond.Message
+		}
+
+		res.Kustomizations = append(res.Kustomizations, ksRes)
+	}
+
+	sort.Slice(res.Kustomizations, func(i, j int) bool {
+		a, b := res.Kustomizations[i], res.Kustomizations[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	res.Status = StatusReady
+	for _, ks := range res.Kustomizations {
+		if !ks.Ready {
+			res.Status = StatusNotReady
+			break
+		}
+	}
+
+	res.setTimes(c.startedAt, c.finishedAt)
+	res.Phases = c.Phases()
+
+	return res, nil
+}
+
+// Phases returns the timings of the phases the client ran so far
+func (c *Client) Phases() []PhaseResult {
+	var phases []PhaseResult
+	for _, phase := range c.report.Cases() {
+		phases = append(phases, PhaseResult{
+			Suite:     phase.Suite,
+			Name:      phase.Name,
+			StartedAt: phase.StartedAt,
+			Duration:  phase.Duration.Round(time.Millisecond).String(),
+			Seconds:   phase.Duration.Seconds(),
+			Status:    phase.Status(),
+		})
+	}
+
+	return phases
+}
+
+// FailedResult describes a run that failed
+func FailedResult(envName string, err error) *Result {
+	return &Result{
+		Env:    envName,
+		Status: StatusFailed,
+		Error:  err.Error(),
+	}
+}
+
+func (r *Result) setTimes(startedAt, finishedAt time.Time) {
+	if startedAt.IsZero() {
+		return
+	}
+
+	r.StartedAt = &startedAt
+
+	if finishedAt.IsZero() {
+		return
+	}
+
+	r.FinishedAt = &finishedAt
+	r.Duration = finishedAt.Sub(startedAt).Round(time.Second).String()
+}
+
+// EnvSummary is a short description of a saved environment
+type EnvSummary struct {
+	Name               string    `json:"name"`
+	Status             string    `json:"status"`
+	KindClusterName    string    `json:"kindClusterName"`
+	GitServer          string    `json:"gitServer"`
+	GiteaContainerName string    `json:"giteaContainerName,omitempty"`
+	GitURL             string    `json:"gitUrl,omitempty"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
+// List returns the saved environments and whether their resources still exist
+func (c *Client) List(ctx context.Context) ([]EnvSummary, error) {
+
+	names, err := listEnvs()
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []EnvSummary
+	for _, name := range names {
+		env, err := LoadEnv(name)
+		if err != nil {
+			return nil, err
+		}
+
+		summary := EnvSummary{
+			Name:            env.Name,
+			Status:          StatusMissing,
+			KindClusterName: env.KindClusterName,
+			GitServer:       env.GitServer,
+			CreatedAt:       env.CreatedAt,
+		}
+
+		envClient := c.withRuntime(env.runtime())
+		provider, providerErr := envClient.clusterProvider(env.ClusterProvider, env.KubeContext)
+		git, gitErr := envClient.newGitServer(env.gitServerOpts())
+		if gitErr == nil {
+			summary.GitServer = git.Name()
+			summary.GitURL = git.URL()
+			if git.Name() == GitServerGitea {
+				summary.GiteaContainerName = env.GiteaContainerName
+			}
+		}
+
+		if providerErr == nil && gitErr == nil {
+			exists, err := envClient.envExists(ctx, provider, git, env.KindClusterName)
+			if err == nil && exists {
+				summary.Status = StatusReady
+			}
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// listEnvs returns the names of the saved environments
+func listEnvs() ([]string, error) {
+	p, err := envPath("")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(p))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+
+	return names, nil
+}
+
+// kubeconfigPath returns the kubeconfig kind writes the cluster credentials to
+func kubeconfigPath() string {
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		return filepath.SplitList(kubeconfig)[0]
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".kube", "config")
+}
@@ -0,0 +1,72 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// rollback is a stack of cleanup functions, every resource we create registers
+// how to remove it so a failed or interrupted run can be undone.
+type rollback struct {
+	mu    sync.Mutex
+	steps []rollbackStep
+	out   io.Writer
+}
+
+type rollbackStep struct {
+	name    string
+	cleanup func(ctx context.Context) error
+}
+
+func newRollback(out io.Writer) *rollback {
+	return &rollback{
+		out: out,
+	}
+}
+
+// Cleanup registers how to remove a resource as soon as it's created, so a failed or interrupted
+// run removes it. the cleanups run in the reverse order of their registration.
+type Cleanup func(name string, cleanup func(ctx context.Context) error)
+
+// add registers the cleanup of a resource, it's safe to call from multiple goroutines.
+func (r *rollback) add(name string, cleanup func(ctx context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.steps = append(r.steps, rollbackStep{
+		name:    name,
+		cleanup: cleanup,
+	})
+}
+
+// run cleans up the resources in the reverse order of their creation.
+// every step runs even if a previous step failed.
+func (r *rollback) run(ctx context.Context) error {
+	r.mu.Lock()
+	steps := r.steps
+	r.steps = nil
+	r.mu.Unlock()
+
+	var genErr error
+	for i := len(steps) - 1; i >= 0; i-- {
+		fmt.Fprintf(r.out, "removing %s \n", steps[i].name)
+
+		err := steps[i].cleanup(ctx)
+		if err != nil {
+			genErr = errors.Join(genErr, fmt.Errorf("failed to remove %s: %w", steps[i].name, err))
+		}
+	}
+
+	return genErr
+}
+
+// CancelFunc returns a function that cleans up all the registered resources.
+// it uses a new context since the run context is usually canceled by then.
+func (r *rollback) CancelFunc() func() error {
+	return func() error {
+		return r.run(context.Background())
+	}
+}
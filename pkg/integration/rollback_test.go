@@ -0,0 +1,35 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackReverseOrder(t *testing.T) {
+
+	rb := newRollback(io.Discard)
+
+	var order []string
+	for _, name := range []string{"container", "cluster", "key"} {
+		name := name
+		rb.add(name, func(ctx context.Context) error {
+			order = append(order, name)
+			if name == "cluster" {
+				return errors.New("boom")
+			}
+			return nil
+		})
+	}
+
+	err := rb.CancelFunc()()
+	require.ErrorContains(t, err, "failed to remove cluster")
+	require.Equal(t, []string{"key", "cluster", "container"}, order)
+
+	// Every step runs only once
+	require.NoError(t, rb.CancelFunc()())
+	require.Len(t, order, 3)
+}
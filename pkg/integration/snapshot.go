@@ -0,0 +1,136 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/snapshot"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// snapshotsDir returns where the snapshots of the environment are saved
+func snapshotsDir(envName string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache dir: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "integration", "snapshots", envName), nil
+}
+
+// removeSnapshots removes all the snapshots of the environment, they can't be restored without its containers
+func removeSnapshots(envName string) error {
+	dir, err := snapshotsDir(envName)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// snapshotClient returns a client that saves the snapshots of the environment
+func (c *Client) snapshotClient() (*snapshot.Client, error) {
+	if c.env == nil {
+		return nil, fmt.Errorf("no environment, create or attach to one first")
+	}
+
+	dir, err := snapshotsDir(c.env.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot.NewClient(dir, c.runtime, c.runner, c.out), nil
+}
+
+// Snapshot saves the state of the cluster nodes and the gitea data, so the environment
+// can be restored to it later. it should be taken after flux converged.
+func (c *Client) Snapshot(ctx context.Context, name string) error {
+
+	snapClient, err := c.snapshotClient()
+	if err != nil {
+		return err
+	}
+
+	provider, err := c.clusterProvider(c.env.ClusterProvider, c.env.KubeContext)
+	if err != nil {
+		return err
+	}
+
+	containers, err := provider.Nodes(ctx, c.env.KindClusterName)
+	if err != nil {
+		return err
+	}
+
+	containers = append(containers, c.git.Containers()...)
+
+	fmt.Fprintf(c.out, "taking snapshot %s of environment %s \n", name, c.env.Name)
+
+	_, err = snapClient.Take(ctx, snapshot.Opts{
+		Name:       name,
+		Containers: containers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to take snapshot %s: %w", name, err)
+	}
+
+	err = c.waitForEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "snapshot %s is ready \n", name)
+
+	return nil
+}
+
+// Restore brings the environment back to the state saved in the snapshot
+func (c *Client) Restore(ctx context.Context, name string) error {
+
+	snapClient, err := c.snapshotClient()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "restoring snapshot %s of environment %s \n", name, c.env.Name)
+
+	_, err = snapClient.Restore(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot %s: %w", name, err)
+	}
+
+	err = c.waitForEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "restored snapshot %s \n", name)
+
+	return nil
+}
+
+// waitForEnv waits until the git server and the cluster are back after their containers were restarted
+func (c *Client) waitForEnv(ctx context.Context) error {
+
+	err := c.git.WaitReady(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The api server takes time to come back, ignore the errors until it does
+	err = wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := c.fluxClient.ListKs(ctx)
+		return err == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("cluster is not ready: %w", err)
+	}
+
+	return c.WaitForKs(ctx, types.NamespacedName{
+		Namespace: "flux-system",
+		Name:      "flux-system",
+	})
+}
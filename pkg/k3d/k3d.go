@@ -0,0 +1,193 @@
+package k3d
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/ezratameno/integration/pkg/cluster"
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+)
+
+// Client creates k3s clusters in docker with the k3d binary, with podman k3d has to
+// reach the podman socket through DOCKER_HOST.
+type Client struct {
+	runtime container.Runtime
+	runner  exec.Runner
+	out     io.Writer
+}
+
+func NewClient(runtime container.Runtime, runner exec.Runner, out io.Writer) *Client {
+	return &Client{
+		runtime: runtime,
+		runner:  runner,
+		out:     out,
+	}
+}
+
+func (c *Client) Name() string {
+	return "k3d"
+}
+
+// Create creates the cluster with the k3d config, the default config is used when configPath is empty.
+// the cluster is added to the kubeconfig without switching the current context.
+// the labels are set on the containers of all the nodes.
+func (c *Client) Create(ctx context.Context, name string, configPath string, labels map[string]string) error {
+	args := []string{"cluster", "create", name, "--wait",
+		"--kubeconfig-update-default", "--kubeconfig-switch-context=false"}
+
+	if configPath != "" {
+		args = append(args, "--config", configPath)
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		args = append(args, "--runtime-label", fmt.Sprintf("%s=%s@all", key, labels[key]))
+	}
+
+	_, err := c.runner.Run(ctx, exec.Command("k3d", args...))
+	if err != nil {
+		return fmt.Errorf("failed to create k3d cluster %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Delete deletes the cluster and removes it from the kubeconfig
+func (c *Client) Delete(ctx context.Context, name string) error {
+	_, err := c.runner.Run(ctx, exec.Command("k3d", "cluster", "delete", name))
+	if err != nil {
+		return fmt.Errorf("failed to delete k3d cluster %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Exists checks if a k3d cluster with the name already exists
+func (c *Client) Exists(ctx context.Context, name string) (bool, error) {
+	res, err := c.runner.Run(ctx, exec.Command("k3d", "cluster", "list", "-o", "json"))
+	if err != nil {
+		return false, fmt.Errorf("failed to list k3d clusters: %w", err)
+	}
+
+	var clusters []struct {
+		Name string `json:"name"`
+	}
+
+	err = json.Unmarshal(res.Stdout, &clusters)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode k3d clusters: %w", err)
+	}
+
+	for _, cluster := range clusters {
+		if cluster.Name == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Kubeconfig returns the kubeconfig of the cluster
+func (c *Client) Kubeconfig(ctx context.Context, name string) ([]byte, error) {
+	res, err := c.runner.Run(ctx, exec.Command("k3d", "kubeconfig", "get", name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubeconfig of cluster %s: %w", name, err)
+	}
+
+	return res.Stdout, nil
+}
+
+// KubeContext returns the kubeconfig context k3d creates for the cluster
+func (c *Client) KubeContext(name string) string {
+	return "k3d-" + name
+}
+
+// Nodes returns the names of the server and agent containers of the cluster,
+// the load balancer in front of the servers is not a node.
+func (c *Client) Nodes(ctx context.Context, name string) ([]string, error) {
+	res, err := c.runner.Run(ctx, exec.Command("k3d", "node", "list", "-o", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes of cluster %s: %w", name, err)
+	}
+
+	var nodes []struct {
+		Name          string            `json:"name"`
+		Role          string            `json:"role"`
+		RuntimeLabels map[string]string `json:"runtimeLabels"`
+	}
+
+	err = json.Unmarshal(res.Stdout, &nodes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode k3d nodes: %w", err)
+	}
+
+	var names []string
+	for _, node := range nodes {
+		if node.RuntimeLabels["k3d.cluster"] != name || (node.Role != "server" && node.Role != "agent") {
+			continue
+		}
+
+		names = append(names, node.Name)
+	}
+
+	return names, nil
+}
+
+// Network returns the network k3d creates for the cluster
+func (c *Client) Network(name string) string {
+	return "k3d-" + name
+}
+
+// LoadImages imports the images to all the nodes of the cluster, one by one since
+// every import of k3d starts its own tools container.
+func (c *Client) LoadImages(ctx context.Context, opts cluster.LoadImagesOpts) error {
+	for _, image := range opts.Images {
+		err := opts.RunPhase(image, func() error {
+			return c.loadImage(ctx, image, opts)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load image %s: %w", image, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) loadImage(ctx context.Context, image string, opts cluster.LoadImagesOpts) error {
+
+	if filepath.Ext(image) != ".tar" {
+		_, err := c.runner.Run(ctx, c.runtime.Command("image", "inspect", image))
+		if err != nil {
+			if !opts.Pull {
+				fmt.Fprintf(c.out, "image %s is not present locally, will not load \n", image)
+				return nil
+			}
+
+			fmt.Fprintf(c.out, "pulling image %s \n", image)
+
+			_, err = c.runner.Run(ctx, c.runtime.Command("pull", image))
+			if err != nil {
+				return fmt.Errorf("failed to pull image: %w", err)
+			}
+		}
+	}
+
+	_, err := c.runner.Run(ctx, exec.Command("k3d", "image", "import", "--cluster", opts.ClusterName, image))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "loaded image %s \n", image)
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package k3d
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ezratameno/integration/pkg/cluster"
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodes(t *testing.T) {
+	runner := exec.NewFakeRunner().On("k3d node list", exec.Result{Stdout: []byte(`[
+  {"name": "k3d-dev-server-0", "role": "server", "runtimeLabels": {"k3d.cluster": "dev"}},
+  {"name": "k3d-dev-agent-0", "role": "agent", "runtimeLabels": {"k3d.cluster": "dev"}},
+  {"name": "k3d-dev-serverlb", "role": "loadbalancer", "runtimeLabels": {"k3d.cluster": "dev"}},
+  {"name": "k3d-other-server-0", "role": "server", "runtimeLabels": {"k3d.cluster": "other"}}
+]`)}, nil)
+
+	c := NewClient(container.Docker, runner, io.Discard)
+
+	nodes, err := c.Nodes(context.Background(), "dev")
+	require.NoError(t, err)
+	require.Equal(t, []string{"k3d-dev-server-0", "k3d-dev-agent-0"}, nodes)
+}
+
+func TestLoadImages(t *testing.T) {
+	runner := exec.NewFakeRunner().
+		OnExit("docker image inspect app:missing", 1, "Error: No such image: app:missing")
+
+	c := NewClient(container.Docker, runner, io.Discard)
+
+	err := c.LoadImages(context.Background(), cluster.LoadImagesOpts{
+		ClusterName: "dev",
+		Images:      []string{"app:latest", "app:missing", "images/db.tar"},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"docker image inspect app:latest",
+		"k3d image import --cluster dev app:latest",
+		"docker image inspect app:missing",
+		"k3d image import --cluster dev images/db.tar",
+	}, runner.Commands())
+}
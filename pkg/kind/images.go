@@ -0,0 +1,327 @@
+package kind
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ezratameno/integration/pkg/cluster"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+)
+
+// image is a single image that should be loaded to the cluster nodes.
+type image struct {
+	// name of the image or the path to the archive
+	name string
+
+	// tags found in the archive
+	tags []string
+
+	// id of the image, used to check if the node already have the image
+	id string
+
+	// path to the archive that will be loaded to the nodes
+	archive string
+}
+
+// LoadImages loads the images to all the nodes of the cluster.
+// images that already exist on a node with the same digest will be skipped.
+func (c *Client) LoadImages(ctx context.Context, opts cluster.LoadImagesOpts) error {
+
+	if len(opts.Images) == 0 {
+		return nil
+	}
+
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 4
+	}
+
+	if opts.CacheDir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("failed to get user cache dir: %w", err)
+		}
+		opts.CacheDir = filepath.Join(cacheDir, "integration", "images")
+	}
+
+	err := os.MkdirAll(opts.CacheDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create images cache dir: %w", err)
+	}
+
+	clusterNodes, err := c.p.ListInternalNodes(opts.ClusterName)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes of cluster %s: %w", opts.ClusterName, err)
+	}
+
+	if len(clusterNodes) == 0 {
+		return fmt.Errorf("no nodes found for cluster %s", opts.ClusterName)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		genErr error
+	)
+
+	sem := make(chan struct{}, opts.Parallelism)
+
+	for _, name := range opts.Images {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := opts.RunPhase(name, func() error {
+				return c.loadImage(ctx, name, clusterNodes, opts)
+			})
+			if err != nil {
+				mu.Lock()
+				genErr = errors.Join(genErr, fmt.Errorf("failed to load image %s: %w", name, err))
+				mu.Unlock()
+			}
+		}(name)
+	}
+
+	wg.Wait()
+
+	return genErr
+}
+
+func (c *Client) loadImage(ctx context.Context, name string, clusterNodes []nodes.Node, opts cluster.LoadImagesOpts) error {
+
+	img, err := c.resolveImage(ctx, name, opts)
+	if err != nil {
+		return err
+	}
+
+	// Image is not present locally and we were not asked to pull it
+	if img == nil {
+		return nil
+	}
+
+	// pick only the nodes that don't have the image
+	var selectedNodes []nodes.Node
+	for _, node := range clusterNodes {
+		if !nodeHasImage(node, img) {
+			selectedNodes = append(selectedNodes, node)
+		}
+	}
+
+	if len(selectedNodes) == 0 {
+		fmt.Fprintf(c.out, "image %s already present on all nodes \n", name)
+		return nil
+	}
+
+	if img.archive == "" {
+		img.archive, err = c.saveImage(ctx, img, opts.CacheDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	errCh := make(chan error)
+	for _, node := range selectedNodes {
+		go func(node nodes.Node) {
+			errCh <- loadArchive(img.archive, node)
+		}(node)
+	}
+
+	var genErr error
+	for i := 0; i < len(selectedNodes); i++ {
+		genErr = errors.Join(genErr, <-errCh)
+	}
+
+	if genErr != nil {
+		return genErr
+	}
+
+	fmt.Fprintf(c.out, "loaded image %s to %d nodes \n", name, len(selectedNodes))
+
+	return nil
+}
+
+// resolveImage finds the image id and tags, either from the archive or from the docker daemon.
+// returns nil if the image is not present locally and should not be pulled.
+func (c *Client) resolveImage(ctx context.Context, name string, opts cluster.LoadImagesOpts) (*image, error) {
+
+	if path.Ext(name) == ".tar" {
+		id, tags, err := inspectArchive(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect archive: %w", err)
+		}
+
+		return &image{
+			name:    name,
+			id:      id,
+			tags:    tags,
+			archive: name,
+		}, nil
+	}
+
+	id, err := c.localImageID(ctx, name)
+	if err != nil {
+		if !opts.Pull {
+			fmt.Fprintf(c.out, "image %s is not present locally, will not load \n", name)
+			return nil, nil
+		}
+
+		fmt.Fprintf(c.out, "pulling image %s \n", name)
+
+		_, err = c.runner.Run(ctx, c.runtime.Command("pull", name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to pull image: %w", err)
+		}
+
+		id, err = c.localImageID(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &image{
+		name: name,
+		id:   id,
+		tags: []string{name},
+	}, nil
+}
+
+// saveImage saves the image from the docker daemon to the cache dir, the archive
+// is named by the image id so the same image will not be saved twice.
+func (c *Client) saveImage(ctx context.Context, img *image, cacheDir string) (string, error) {
+
+	archive := filepath.Join(cacheDir, strings.TrimPrefix(img.id, "sha256:")+".tar")
+
+	_, err := os.Stat(archive)
+	if err == nil {
+		return archive, nil
+	}
+
+	// Save to a temp dir first so a failed save will not leave a broken archive in the cache
+	tmpDir, err := os.MkdirTemp(cacheDir, "save-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmp := filepath.Join(tmpDir, filepath.Base(archive))
+
+	_, err = c.runner.Run(ctx, c.runtime.Command("save", "-o", tmp, img.name))
+	if err != nil {
+		return "", fmt.Errorf("failed to save image: %w", err)
+	}
+
+	err = os.Rename(tmp, archive)
+	if err != nil {
+		return "", err
+	}
+
+	return archive, nil
+}
+
+// localImageID returns the id of the image in the container runtime
+func (c *Client) localImageID(ctx context.Context, name string) (string, error) {
+	res, err := c.runner.Run(ctx, c.runtime.Command("image", "inspect", "-f", "{{ .Id }}", name))
+	if err != nil {
+		return "", fmt.Errorf("image %s not present locally: %w", name, err)
+	}
+
+	// podman prints the id without the algorithm, the nodes have it with it
+	id := strings.TrimSpace(string(res.Stdout))
+	if !strings.HasPrefix(id, "sha256:") {
+		id = "sha256:" + id
+	}
+
+	return id, nil
+}
+
+// nodeHasImage checks if all the tags of the image exist on the node with the same id
+func nodeHasImage(node nodes.Node, img *image) bool {
+
+	// We can't know what is in the archive, so we have to load it
+	if img.id == "" || len(img.tags) == 0 {
+		return false
+	}
+
+	for _, tag := range img.tags {
+		id, err := nodeutils.ImageID(node, tag)
+		if err != nil || id != img.id {
+			return false
+		}
+	}
+
+	return true
+}
+
+func loadArchive(archive string, node nodes.Node) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = nodeutils.LoadImageArchive(node, f)
+	if err != nil {
+		return fmt.Errorf("node %s: %w", node.String(), err)
+	}
+
+	return nil
+}
+
+// archiveManifest is the manifest.json written by docker save
+type archiveManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+}
+
+// inspectArchive returns the image id and tags from an image archive.
+// if the archive contains more than one image the id will be empty.
+func inspectArchive(archive string) (string, []string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", nil, nil
+		}
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		if hdr.Name != "manifest.json" {
+			continue
+		}
+
+		var manifests []archiveManifest
+		err = json.NewDecoder(tr).Decode(&manifests)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decode manifest.json: %w", err)
+		}
+
+		if len(manifests) != 1 {
+			return "", nil, nil
+		}
+
+		// Config is either <id>.json or blobs/sha256/<id>
+		id := strings.TrimSuffix(path.Base(manifests[0].Config), ".json")
+
+		return "sha256:" + id, manifests[0].RepoTags, nil
+	}
+}
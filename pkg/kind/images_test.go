@@ -0,0 +1,125 @@
+package kind
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ezratameno/integration/pkg/cluster"
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/stretchr/testify/require"
+)
+
+// writeArchive writes an image archive with the manifest.json of docker save
+func writeArchive(t *testing.T, manifest string) string {
+	archive := filepath.Join(t.TempDir(), "image.tar")
+
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "repositories", Mode: 0644}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest))}))
+	_, err = tw.Write([]byte(manifest))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	return archive
+}
+
+func TestInspectArchive(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		id       string
+		tags     []string
+	}{
+		{
+			name:     "legacy config",
+			manifest: `[{"Config":"abc123.json","RepoTags":["app:latest"]}]`,
+			id:       "sha256:abc123",
+			tags:     []string{"app:latest"},
+		},
+		{
+			name:     "oci config",
+			manifest: `[{"Config":"blobs/sha256/def456","RepoTags":["app:v1","app:latest"]}]`,
+			id:       "sha256:def456",
+			tags:     []string{"app:v1", "app:latest"},
+		},
+		{
+			name:     "many images",
+			manifest: `[{"Config":"abc123.json","RepoTags":["app:latest"]},{"Config":"def456.json","RepoTags":["db:latest"]}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, tags, err := inspectArchive(writeArchive(t, tt.manifest))
+			require.NoError(t, err)
+			require.Equal(t, tt.id, id)
+			require.Equal(t, tt.tags, tags)
+		})
+	}
+}
+
+func TestResolveImage(t *testing.T) {
+	ctx := context.Background()
+
+	runner := exec.NewFakeRunner().
+		On("podman image inspect -f {{ .Id }} app:latest", exec.Result{Stdout: []byte("abc123\n")}, nil).
+		OnExit("podman image inspect -f {{ .Id }} app:missing", 125, "Error: app:missing: image not known")
+
+	c := NewClient(container.Podman, runner, io.Discard)
+
+	// podman prints the id without the algorithm
+	img, err := c.resolveImage(ctx, "app:latest", cluster.LoadImagesOpts{})
+	require.NoError(t, err)
+	require.Equal(t, &image{name: "app:latest", id: "sha256:abc123", tags: []string{"app:latest"}}, img)
+
+	img, err = c.resolveImage(ctx, "app:missing", cluster.LoadImagesOpts{})
+	require.NoError(t, err)
+	require.Nil(t, img)
+
+	// A pulled image is inspected again, it's still missing in the fake runner
+	_, err = c.resolveImage(ctx, "app:missing", cluster.LoadImagesOpts{Pull: true})
+	require.ErrorContains(t, err, "not present locally")
+	require.Contains(t, runner.Commands(), "podman pull app:missing")
+
+	archive := writeArchive(t, `[{"Config":"abc123.json","RepoTags":["app:latest"]}]`)
+	img, err = c.resolveImage(ctx, archive, cluster.LoadImagesOpts{})
+	require.NoError(t, err)
+	require.Equal(t, &image{name: archive, id: "sha256:abc123", tags: []string{"app:latest"}, archive: archive}, img)
+}
+
+func TestSaveImage(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+
+	runner := exec.NewFakeRunner().OnExit("docker save", 1, "Error response from daemon: no such image")
+	c := NewClient(container.Docker, runner, io.Discard)
+
+	// A failed save leaves nothing in the cache
+	_, err := c.saveImage(ctx, &image{name: "app:latest", id: "sha256:abc123"}, cacheDir)
+	require.ErrorContains(t, err, "failed to save image")
+
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// The archive of the same image is saved once
+	cached := filepath.Join(cacheDir, "def456.tar")
+	require.NoError(t, os.WriteFile(cached, nil, 0644))
+
+	runner = exec.NewFakeRunner()
+	c = NewClient(container.Docker, runner, io.Discard)
+
+	archive, err := c.saveImage(ctx, &image{name: "db:latest", id: "sha256:def456"}, cacheDir)
+	require.NoError(t, err)
+	require.Equal(t, cached, archive)
+	require.Empty(t, runner.Commands())
+}
@@ -1,37 +1,187 @@
 package kind
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"path"
 
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
 	"sigs.k8s.io/kind/pkg/cluster"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ClusterLabel is the label kind sets on the node containers with the name of their cluster
+	ClusterLabel = "io.x-k8s.kind.cluster"
+
+	// ControlPlaneLabel selects the control plane node containers, every cluster has one
+	ControlPlaneLabel = "io.x-k8s.kind.role=control-plane"
 )
 
 type Client struct {
-	p *cluster.Provider
+	p       *cluster.Provider
+	runtime container.Runtime
+	runner  exec.Runner
+	out     io.Writer
 }
 
-func NewClient() *Client {
-	p := cluster.NewProvider(cluster.ProviderWithDocker())
+// NewClient returns a client that runs the nodes with the container runtime
+func NewClient(runtime container.Runtime, runner exec.Runner, out io.Writer) *Client {
+	providerOpt := cluster.ProviderWithDocker()
+	if runtime == container.Podman {
+		providerOpt = cluster.ProviderWithPodman()
+	}
 
 	c := &Client{
-		p: p,
+		p:       cluster.NewProvider(providerOpt),
+		runtime: runtime,
+		runner:  runner,
+		out:     out,
 	}
 
 	return c
 }
 
-func (c *Client) CreateClusterWithConfig(name string, configPath string) error {
-	return c.p.Create(name, cluster.CreateWithConfigFile(configPath))
+func (c *Client) Name() string {
+	return "kind"
+}
+
+// Create creates the cluster with the kind config, the default config is used when configPath is empty.
+// kind can't label the node containers, so the labels are set on the kubernetes nodes and read with NodeLabels.
+func (c *Client) Create(ctx context.Context, name string, configPath string, labels map[string]string) error {
+	cfg, err := loadConfig(name, configPath)
+	if err != nil {
+		return err
+	}
+
+	for i := range cfg.Nodes {
+		if cfg.Nodes[i].Labels == nil {
+			cfg.Nodes[i].Labels = make(map[string]string)
+		}
+
+		for key, value := range labels {
+			cfg.Nodes[i].Labels[key] = value
+		}
+	}
+
+	return c.p.Create(name, cluster.CreateWithV1Alpha4Config(cfg))
 }
 
-func (c *Client) DeleteCluster(name string) error {
+// Delete deletes the cluster and removes it from the kubeconfig kind wrote it to,
+// which is $KUBECONFIG or ~/.kube/config.
+func (c *Client) Delete(ctx context.Context, name string) error {
+	return c.p.Delete(name, "")
+}
 
-	home, err := os.UserHomeDir()
+// NodeLabels returns the kubernetes labels of the node of the container, they are read with the kubectl
+// and the admin kubeconfig of the node so the cluster doesn't have to be in our kubeconfig.
+// the node must be running.
+func (c *Client) NodeLabels(ctx context.Context, node string) (map[string]string, error) {
+	res, err := c.runner.Run(ctx, c.runtime.Command("exec", node, "kubectl", "--kubeconfig", "/etc/kubernetes/admin.conf",
+		"get", "node", node, "-o", "jsonpath={.metadata.labels}"))
 	if err != nil {
-		return fmt.Errorf("failed to get user home dir: %w", err)
+		return nil, fmt.Errorf("failed to get labels of node %s: %w", node, err)
 	}
 
-	return c.p.Delete(name, path.Join(home, ".kube", "config"))
+	var labels map[string]string
+	err = json.Unmarshal(res.Stdout, &labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode labels of node %s: %w", node, err)
+	}
+
+	return labels, nil
+}
+
+// Exists checks if a kind cluster with the name already exists
+func (c *Client) Exists(ctx context.Context, name string) (bool, error) {
+	clusters, err := c.p.List()
+	if err != nil {
+		return false, fmt.Errorf("failed to list kind clusters: %w", err)
+	}
+
+	for _, cluster := range clusters {
+		if cluster == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Kubeconfig returns the kubeconfig of the cluster
+func (c *Client) Kubeconfig(ctx context.Context, name string) ([]byte, error) {
+	kubeconfig, err := c.p.KubeConfig(name, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubeconfig of cluster %s: %w", name, err)
+	}
+
+	return []byte(kubeconfig), nil
+}
+
+// KubeContext returns the kubeconfig context kind creates for the cluster
+func (c *Client) KubeContext(name string) string {
+	return "kind-" + name
+}
+
+// Nodes returns the names of the node containers of the cluster
+func (c *Client) Nodes(ctx context.Context, name string) ([]string, error) {
+	clusterNodes, err := c.p.ListNodes(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes of cluster %s: %w", name, err)
+	}
+
+	var names []string
+	for _, node := range clusterNodes {
+		names = append(names, node.String())
+	}
+
+	return names, nil
+}
+
+// Network returns the network kind creates the nodes in, it's shared by all the kind clusters
+func (c *Client) Network(name string) string {
+	if network := os.Getenv("KIND_EXPERIMENTAL_DOCKER_NETWORK"); network != "" {
+		return network
+	}
+
+	return "kind"
+}
+
+// RenderConfig returns the config the cluster would be created with, the config file
+// with the name of the cluster and the defaults kind sets.
+func RenderConfig(name string, configPath string) ([]byte, error) {
+	cfg, err := loadConfig(name, configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(cfg)
+}
+
+// loadConfig reads the kind config and sets the name of the cluster and the defaults
+func loadConfig(name string, configPath string) (*v1alpha4.Cluster, error) {
+	var cfg v1alpha4.Cluster
+
+	if configPath != "" {
+		body, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kind config: %w", err)
+		}
+
+		err = yaml.UnmarshalStrict(body, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode kind config %s: %w", configPath, err)
+		}
+	}
+
+	cfg.Kind = "Cluster"
+	cfg.APIVersion = "kind.x-k8s.io/v1alpha4"
+	cfg.Name = name
+	v1alpha4.SetDefaultsCluster(&cfg)
+
+	return &cfg, nil
 }
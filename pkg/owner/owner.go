@@ -0,0 +1,69 @@
+package owner
+
+import (
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The labels of the resources created for an environment, so the resources left behind
+// by a run that crashed can be found and removed. they are valid both as container labels
+// and as kubernetes labels.
+const (
+	EnvLabel       = "integration.ezratameno.io/env"
+	CreatedAtLabel = "integration.ezratameno.io/created-at"
+	OwnerLabel     = "integration.ezratameno.io/owner"
+)
+
+// timeFormat is a valid kubernetes label value, it can't have colons
+const timeFormat = "20060102T150405Z"
+
+var invalidValueChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// Labels returns the labels of the resources of the environment
+func Labels(env string, createdAt time.Time) map[string]string {
+	return map[string]string{
+		EnvLabel:       env,
+		CreatedAtLabel: createdAt.UTC().Format(timeFormat),
+		OwnerLabel:     Current(),
+	}
+}
+
+// Merge returns the labels of all the maps, the later maps win
+func Merge(labels ...map[string]string) map[string]string {
+	res := make(map[string]string)
+	for _, m := range labels {
+		for key, value := range m {
+			res[key] = value
+		}
+	}
+
+	return res
+}
+
+// CreatedAt returns when the resource with the labels was created
+func CreatedAt(labels map[string]string) (time.Time, error) {
+	return time.Parse(timeFormat, labels[CreatedAtLabel])
+}
+
+// Owned checks if the resource with the labels was created by the current user
+func Owned(labels map[string]string) bool {
+	_, ok := labels[EnvLabel]
+	return ok && labels[OwnerLabel] == Current()
+}
+
+// Current returns the name of the current user as a label value
+func Current() string {
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+
+	name := invalidValueChars.ReplaceAllString(u.Username, "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+
+	return strings.Trim(name, "-_.")
+}
@@ -0,0 +1,28 @@
+package owner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+
+	createdAt := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	labels := Labels("integration", createdAt)
+	require.Equal(t, "integration", labels[EnvLabel])
+	require.Equal(t, "20240301T103000Z", labels[CreatedAtLabel])
+	require.True(t, Owned(labels))
+
+	parsed, err := CreatedAt(labels)
+	require.NoError(t, err)
+	require.True(t, createdAt.Equal(parsed))
+
+	// Someone else's environment
+	labels[OwnerLabel] = "other"
+	require.False(t, Owned(labels))
+
+	require.False(t, Owned(map[string]string{OwnerLabel: Current()}))
+}
@@ -0,0 +1,163 @@
+package redact
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ezratameno/integration/pkg/exec"
+)
+
+// Mask replaces the secrets
+const Mask = "*****"
+
+// minSecretLength is the length a secret must have to be masked, shorter
+// values would mask unrelated parts of the output.
+const minSecretLength = 4
+
+// patterns mask secrets that were not registered, like flags and private keys
+var patterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{
+		re:          regexp.MustCompile(`(?i)(--(?:password|token|secret)[= ])("[^"]*"|\S+)`),
+		replacement: "${1}" + Mask,
+	},
+	{
+		re:          regexp.MustCompile(`(?i)(authorization:\s*\w+\s+)\S+`),
+		replacement: "${1}" + Mask,
+	},
+	{
+		re:          regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		replacement: Mask,
+	},
+}
+
+// Redactor masks secrets in strings, errors and output streams.
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+func New() *Redactor {
+	return &Redactor{}
+}
+
+// Add registers secrets that should be masked
+func (r *Redactor) Add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			continue
+		}
+
+		r.secrets = append(r.secrets, secret)
+	}
+
+	// Mask the longest secrets first in case a secret contains another one
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// String masks the secrets in s
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	r.mu.RUnlock()
+
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+
+	return s
+}
+
+// Error masks the secrets in the error message, the original error can still be unwrapped.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := r.String(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+
+	return &redactedError{
+		msg: msg,
+		err: err,
+	}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Writer returns a writer that masks the secrets before writing to w.
+// secrets are masked per write, so a secret split across writes is not masked.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &writer{
+		r: r,
+		w: w,
+	}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	_, err := io.WriteString(w.w, w.r.String(string(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Runner returns a runner that masks the secrets in the output streams and errors of the commands.
+// the results are returned as they are, the callers parse them as data like json or kubeconfigs.
+func (r *Redactor) Runner(runner exec.Runner) exec.Runner {
+	return &redactRunner{
+		r:      r,
+		runner: runner,
+	}
+}
+
+type redactRunner struct {
+	r      *Redactor
+	runner exec.Runner
+}
+
+func (rr *redactRunner) Run(ctx context.Context, cmd exec.Cmd) (exec.Result, error) {
+	if cmd.Stdout != nil {
+		cmd.Stdout = rr.r.Writer(cmd.Stdout)
+	}
+
+	if cmd.Stderr != nil {
+		cmd.Stderr = rr.r.Writer(cmd.Stderr)
+	}
+
+	res, err := rr.runner.Run(ctx, cmd)
+
+	return res, rr.r.Error(err)
+}
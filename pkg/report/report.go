@@ -0,0 +1,261 @@
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Case is a phase of the run, like creating the kind cluster or waiting for a kustomization
+type Case struct {
+	Suite     string
+	Name      string
+	StartedAt time.Time
+	Duration  time.Duration
+
+	// Failure is the error of the phase, empty when it passed
+	Failure string
+	Skipped bool
+}
+
+// Status returns passed, failed or skipped
+func (c Case) Status() string {
+	switch {
+	case c.Failure != "":
+		return "failed"
+	case c.Skipped:
+		return "skipped"
+	}
+
+	return "passed"
+}
+
+// End returns when the phase finished
+func (c Case) End() time.Time {
+	return c.StartedAt.Add(c.Duration)
+}
+
+// Report collects the phases of a run, it's safe for concurrent use
+type Report struct {
+	mu    sync.Mutex
+	name  string
+	cases []Case
+}
+
+func New(name string) *Report {
+	return &Report{
+		name: name,
+	}
+}
+
+// Add adds a case to the report
+func (r *Report) Add(c Case) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cases = append(r.cases, c)
+}
+
+// Phase runs fn and adds its duration and error as a case
+func (r *Report) Phase(suite, name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	c := Case{
+		Suite:     suite,
+		Name:      name,
+		StartedAt: start,
+		Duration:  time.Since(start),
+	}
+
+	if err != nil {
+		c.Failure = err.Error()
+	}
+
+	r.Add(c)
+
+	return err
+}
+
+// Cases returns the cases by the order they were added
+func (r *Report) Cases() []Case {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Case{}, r.cases...)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML, every suite is a testsuite
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{
+		Name: r.name,
+	}
+
+	var total time.Duration
+	var suiteTimes []time.Duration
+	index := make(map[string]int)
+
+	for _, c := range r.Cases() {
+		i, ok := index[c.Suite]
+		if !ok {
+			i = len(suites.Suites)
+			index[c.Suite] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{
+				Name:      c.Suite,
+				Timestamp: c.StartedAt.UTC().Format(time.RFC3339),
+			})
+			suiteTimes = append(suiteTimes, 0)
+		}
+
+		suite := &suites.Suites[i]
+		tc := junitTestCase{
+			ClassName: fmt.Sprintf("%s.%s", r.name, c.Suite),
+			Name:      c.Name,
+			Time:      seconds(c.Duration),
+		}
+
+		suite.Tests++
+		suites.Tests++
+
+		switch {
+		case c.Failure != "":
+			tc.Failure = &junitFailure{
+				Message: firstLine(c.Failure),
+				Body:    c.Failure,
+			}
+			suite.Failures++
+			suites.Failures++
+
+		case c.Skipped:
+			tc.Skipped = &struct{}{}
+			suite.Skipped++
+			suites.Skipped++
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+		suiteTimes[i] += c.Duration
+		total += c.Duration
+	}
+
+	for i := range suites.Suites {
+		suites.Suites[i].Time = seconds(suiteTimes[i])
+	}
+	suites.Time = seconds(total)
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(suites)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+type jsonCase struct {
+	Suite     string    `json:"suite"`
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"startedAt"`
+	Seconds   float64   `json:"seconds"`
+	Status    string    `json:"status"`
+	Failure   string    `json:"failure,omitempty"`
+}
+
+// WriteJSON writes the report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	doc := struct {
+		Name  string     `json:"name"`
+		Cases []jsonCase `json:"cases"`
+	}{
+		Name:  r.name,
+		Cases: []jsonCase{},
+	}
+
+	for _, c := range r.Cases() {
+		doc.Cases = append(doc.Cases, jsonCase{
+			Suite:     c.Suite,
+			Name:      c.Name,
+			StartedAt: c.StartedAt,
+			Seconds:   c.Duration.Seconds(),
+			Status:    c.Status(),
+			Failure:   c.Failure,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// WriteFile writes the report to path with write, like WriteJUnit
+func (r *Report) WriteFile(path string, write func(r *Report, w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+
+	err = write(r, f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+
+	return f.Close()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func firstLine(s string) string {
+	for i, c := range s {
+		if c == '\n' {
+			return s[:i]
+		}
+	}
+
+	return s
+}
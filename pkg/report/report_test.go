@@ -0,0 +1,77 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	r := New("integration")
+
+	require.NoError(t, r.Phase("setup", "kind", func() error { return nil }))
+	require.Error(t, r.Phase("wait", "flux-system/apps", func() error {
+		return errors.New("not ready\nhealth check failed")
+	}))
+	r.Add(Case{Suite: "wait", Name: "flux-system/infra", Skipped: true})
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteJUnit(&buf))
+
+	out := buf.String()
+	require.Contains(t, out, `<testsuites name="integration" tests="3" failures="1" skipped="1"`)
+	require.Contains(t, out, `<testsuite name="wait" tests="2" failures="1" skipped="1"`)
+	require.Contains(t, out, `<failure message="not ready">not ready&#xA;health check failed</failure>`)
+	require.Contains(t, out, `<skipped></skipped>`)
+}
+
+func TestWriteTrace(t *testing.T) {
+	r := New("integration")
+
+	start := time.Now()
+	r.Add(Case{Suite: "setup", Name: "kind", StartedAt: start, Duration: 10 * time.Second})
+	r.Add(Case{Suite: "setup", Name: "gitea", StartedAt: start, Duration: 5 * time.Second})
+	r.Add(Case{Suite: "setup", Name: "bootstrap", StartedAt: start.Add(10 * time.Second), Duration: time.Second})
+
+	// Skipped without a start time
+	r.Add(Case{Suite: "reconcile", Name: "flux-system/apps", Skipped: true})
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteTrace(&buf))
+
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+
+	// The parallel phases are on different threads, bootstrap reuses the first one
+	tids := map[string]int{}
+	for _, e := range trace.TraceEvents {
+		tids[e.Name] = e.Tid
+	}
+	require.Equal(t, map[string]int{"kind": 1, "gitea": 2, "bootstrap": 1}, tids)
+	require.Equal(t, int64(10_000_000), trace.TraceEvents[2].Ts)
+}
+
+func TestWriteSummary(t *testing.T) {
+	r := New("integration")
+
+	start := time.Now()
+	r.Add(Case{Suite: "setup", Name: "kind", StartedAt: start, Duration: 10 * time.Second})
+	r.Add(Case{Suite: "reconcile", Name: "flux-system/apps", Skipped: true})
+
+	_, total := r.Span()
+	require.Equal(t, 10*time.Second, total)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteSummary(&buf))
+
+	out := buf.String()
+	require.Contains(t, out, "setup/kind")
+	require.Regexp(t, `reconcile/flux-system/apps\s+-\s+-\s+-\s+skipped`, out)
+	require.Regexp(t, `total\s+10s`, out)
+}
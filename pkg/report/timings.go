@@ -0,0 +1,167 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// timed splits the phases by whether they have a start time, the phases which were skipped
+// without running may have none
+func timed(cases []Case) ([]Case, []Case) {
+	var withTime, withoutTime []Case
+	for _, c := range cases {
+		if c.StartedAt.IsZero() {
+			withoutTime = append(withoutTime, c)
+			continue
+		}
+
+		withTime = append(withTime, c)
+	}
+
+	return withTime, withoutTime
+}
+
+// Span returns when the first phase started and how long it took until the last phase finished,
+// the phases without a start time are ignored
+func (r *Report) Span() (time.Time, time.Duration) {
+	cases, _ := timed(r.Cases())
+	if len(cases) == 0 {
+		return time.Time{}, 0
+	}
+
+	start, end := cases[0].StartedAt, cases[0].End()
+	for _, c := range cases[1:] {
+		if c.StartedAt.Before(start) {
+			start = c.StartedAt
+		}
+
+		if c.End().After(end) {
+			end = c.End()
+		}
+	}
+
+	return start, end.Sub(start)
+}
+
+// WriteSummary writes a table of the phases by the time they started, with the offset from the
+// start of the run and the share of the run each phase took. phases run in parallel so the
+// shares don't add up to 100%. the phases without a start time are listed last without timings.
+func (r *Report) WriteSummary(w io.Writer) error {
+	cases, untimed := timed(r.Cases())
+	if len(cases) == 0 && len(untimed) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(cases, func(i, j int) bool {
+		return cases[i].StartedAt.Before(cases[j].StartedAt)
+	})
+
+	start, total := r.Span()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tSTART\tDURATION\tSHARE\tSTATUS")
+	for _, c := range cases {
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(c.Duration) / float64(total)
+		}
+
+		fmt.Fprintf(tw, "%s/%s\t+%s\t%s\t%.0f%%\t%s\n", c.Suite, c.Name, roundDuration(c.StartedAt.Sub(start)),
+			roundDuration(c.Duration), share, c.Status())
+	}
+	for _, c := range untimed {
+		fmt.Fprintf(tw, "%s/%s\t-\t-\t-\t%s\n", c.Suite, c.Name, c.Status())
+	}
+	fmt.Fprintf(tw, "total\t\t%s\t\t\n", roundDuration(total))
+
+	return tw.Flush()
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+
+	return d.Round(100 * time.Millisecond)
+}
+
+// traceEvent is a complete event of the chrome trace event format
+type traceEvent struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat"`
+	Ph   string            `json:"ph"`
+	Ts   int64             `json:"ts"`
+	Dur  int64             `json:"dur"`
+	Pid  int               `json:"pid"`
+	Tid  int               `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// WriteTrace writes the phases in the chrome trace event format, it can be opened in
+// chrome://tracing or https://ui.perfetto.dev. phases which overlap are put on different
+// threads, so the parallel phases are shown side by side. the phases without a start time are left out.
+func (r *Report) WriteTrace(w io.Writer) error {
+	cases, _ := timed(r.Cases())
+
+	// Longer phases first so a phase which contains another gets the lower thread
+	sort.SliceStable(cases, func(i, j int) bool {
+		if !cases[i].StartedAt.Equal(cases[j].StartedAt) {
+			return cases[i].StartedAt.Before(cases[j].StartedAt)
+		}
+		return cases[i].Duration > cases[j].Duration
+	})
+
+	start, _ := r.Span()
+
+	// The end of the last phase of each thread
+	var threads []time.Time
+
+	events := []traceEvent{}
+	for _, c := range cases {
+		tid := -1
+		for i, end := range threads {
+			if !c.StartedAt.Before(end) {
+				tid = i
+				break
+			}
+		}
+
+		if tid == -1 {
+			tid = len(threads)
+			threads = append(threads, time.Time{})
+		}
+		threads[tid] = c.End()
+
+		args := map[string]string{
+			"status": c.Status(),
+		}
+		if c.Failure != "" {
+			args["failure"] = c.Failure
+		}
+
+		events = append(events, traceEvent{
+			Name: c.Name,
+			Cat:  c.Suite,
+			Ph:   "X",
+			Ts:   c.StartedAt.Sub(start).Microseconds(),
+			Dur:  c.Duration.Microseconds(),
+			Pid:  1,
+			Tid:  tid + 1,
+			Args: args,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{
+		TraceEvents:     events,
+		DisplayTimeUnit: "ms",
+	})
+}
@@ -0,0 +1,275 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+)
+
+// Client takes snapshots of the volumes of containers and restores them.
+// the containers are stopped while their volumes are copied so the data is consistent.
+type Client struct {
+	runtime container.Runtime
+	runner  exec.Runner
+	out     io.Writer
+
+	// dir where the snapshots are saved
+	dir string
+}
+
+func NewClient(dir string, runtime container.Runtime, runner exec.Runner, out io.Writer) *Client {
+	c := &Client{
+		dir:     dir,
+		runtime: runtime,
+		runner:  runner,
+		out:     out,
+	}
+
+	return c
+}
+
+// Snapshot describes a saved snapshot
+type Snapshot struct {
+	Name       string      `json:"name"`
+	Containers []Container `json:"containers"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+type Container struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+
+	// Volumes are the paths in the container that are mounted as volumes
+	Volumes []string `json:"volumes"`
+}
+
+type Opts struct {
+	// Name of the snapshot
+	Name string
+
+	// Containers to snapshot, they are stopped and started by this order
+	Containers []string
+}
+
+const metadataFile = "snapshot.json"
+
+// Take saves the volumes of the containers, the containers are started again when it's done.
+func (c *Client) Take(ctx context.Context, opts Opts) (*Snapshot, error) {
+
+	snapDir := filepath.Join(c.dir, opts.Name)
+
+	// Save to a temp dir first so a failed snapshot will not override a good one
+	tmpDir := snapDir + ".tmp"
+	err := os.RemoveAll(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(tmpDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+
+	snap := &Snapshot{
+		Name:      opts.Name,
+		CreatedAt: time.Now(),
+	}
+
+	for _, name := range opts.Containers {
+		container, err := c.inspect(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		snap.Containers = append(snap.Containers, container)
+	}
+
+	err = c.stop(ctx, opts.Containers)
+	if err != nil {
+		return nil, err
+	}
+
+	var genErr error
+	for _, container := range snap.Containers {
+		fmt.Fprintf(c.out, "saving volumes of %s \n", container.Name)
+
+		for _, volume := range container.Volumes {
+			cmd := fmt.Sprintf("tar -C %s -cf /snapshot/%s .", volume, archiveName(container.Name, volume))
+			err := c.runWithVolumes(ctx, container, tmpDir, cmd)
+			if err != nil {
+				genErr = errors.Join(genErr, fmt.Errorf("failed to save volume %s of %s: %w", volume, container.Name, err))
+			}
+		}
+	}
+
+	// Start the containers even if the snapshot failed so the environment can still be used
+	err = c.start(ctx, opts.Containers)
+	if err != nil {
+		genErr = errors.Join(genErr, err)
+	}
+
+	if genErr != nil {
+		os.RemoveAll(tmpDir)
+		return nil, genErr
+	}
+
+	body, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(filepath.Join(tmpDir, metadataFile), body, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.RemoveAll(snapDir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(tmpDir, snapDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// Restore replaces the volumes of the containers with the ones saved in the snapshot.
+// the containers must be the same ones the snapshot was taken from.
+func (c *Client) Restore(ctx context.Context, name string) (*Snapshot, error) {
+
+	snap, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	snapDir := filepath.Join(c.dir, name)
+
+	var containers []string
+	for _, container := range snap.Containers {
+		containers = append(containers, container.Name)
+	}
+
+	err = c.stop(ctx, containers)
+	if err != nil {
+		return nil, err
+	}
+
+	var genErr error
+	for _, container := range snap.Containers {
+		fmt.Fprintf(c.out, "restoring volumes of %s \n", container.Name)
+
+		for _, volume := range container.Volumes {
+			cmd := fmt.Sprintf("find %s -mindepth 1 -delete && tar -C %s -xpf /snapshot/%s", volume, volume, archiveName(container.Name, volume))
+			err := c.runWithVolumes(ctx, container, snapDir, cmd)
+			if err != nil {
+				genErr = errors.Join(genErr, fmt.Errorf("failed to restore volume %s of %s: %w", volume, container.Name, err))
+			}
+		}
+	}
+
+	err = c.start(ctx, containers)
+	if err != nil {
+		genErr = errors.Join(genErr, err)
+	}
+
+	if genErr != nil {
+		return nil, genErr
+	}
+
+	return snap, nil
+}
+
+// Get returns the snapshot metadata
+func (c *Client) Get(name string) (*Snapshot, error) {
+
+	body, err := os.ReadFile(filepath.Join(c.dir, name, metadataFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("snapshot %s not found", name)
+		}
+		return nil, err
+	}
+
+	var snap Snapshot
+	err = json.Unmarshal(body, &snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", name, err)
+	}
+
+	return &snap, nil
+}
+
+// Delete removes the snapshot
+func (c *Client) Delete(name string) error {
+	return os.RemoveAll(filepath.Join(c.dir, name))
+}
+
+// inspect returns the image and the volumes of the container, bind mounts are skipped
+// since they are owned by the host.
+func (c *Client) inspect(ctx context.Context, name string) (Container, error) {
+
+	res, err := c.runner.Run(ctx, c.runtime.Command("container", "inspect", "-f",
+		`{{.Config.Image}}{{range .Mounts}}{{if eq .Type "volume"}} {{.Destination}}{{end}}{{end}}`, name))
+	if err != nil {
+		return Container{}, fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+
+	fields := strings.Fields(string(res.Stdout))
+	if len(fields) == 0 {
+		return Container{}, fmt.Errorf("failed to inspect container %s: empty output", name)
+	}
+
+	return Container{
+		Name:    name,
+		Image:   fields[0],
+		Volumes: fields[1:],
+	}, nil
+}
+
+// runWithVolumes runs the script in a temporary container that has the volumes of the container
+// and the snapshot dir mounted. the image of the container is used so we don't need to pull a helper image.
+func (c *Client) runWithVolumes(ctx context.Context, container Container, snapDir string, script string) error {
+
+	_, err := c.runner.Run(ctx, c.runtime.Command("run", "--rm",
+		"--volumes-from", container.Name,
+		"-v", snapDir+":/snapshot",
+		"--entrypoint", "sh",
+		container.Image, "-c", script))
+
+	return err
+}
+
+func (c *Client) stop(ctx context.Context, containers []string) error {
+	_, err := c.runner.Run(ctx, c.runtime.Command(append([]string{"container", "stop"}, containers...)...))
+	if err != nil {
+		return fmt.Errorf("failed to stop containers: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) start(ctx context.Context, containers []string) error {
+	_, err := c.runner.Run(ctx, c.runtime.Command(append([]string{"container", "start"}, containers...)...))
+	if err != nil {
+		return fmt.Errorf("failed to start containers: %w", err)
+	}
+
+	return nil
+}
+
+// archiveName returns the name of the archive of a volume of the container
+func archiveName(container string, volume string) string {
+	return fmt.Sprintf("%s%s.tar", container, strings.ReplaceAll(volume, "/", "_"))
+}
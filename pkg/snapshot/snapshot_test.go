@@ -0,0 +1,89 @@
+package snapshot
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ezratameno/integration/pkg/container"
+	"github.com/ezratameno/integration/pkg/exec"
+	"github.com/stretchr/testify/require"
+)
+
+const inspectFormat = `{{.Config.Image}}{{range .Mounts}}{{if eq .Type "volume"}} {{.Destination}}{{end}}{{end}}`
+
+func TestTakeAndRestore(t *testing.T) {
+	dir := t.TempDir()
+
+	runner := exec.NewFakeRunner().
+		On("docker container inspect -f "+inspectFormat+" gitea", exec.Result{Stdout: []byte("gitea/gitea:1.22.1 /data\n")}, nil).
+		On("docker container inspect -f "+inspectFormat+" dev-control-plane", exec.Result{Stdout: []byte("kindest/node:v1.30.0 /var /lib/modules\n")}, nil)
+
+	c := NewClient(dir, container.Docker, runner, io.Discard)
+
+	snap, err := c.Take(context.Background(), Opts{Name: "base", Containers: []string{"gitea", "dev-control-plane"}})
+	require.NoError(t, err)
+	require.Equal(t, []Container{
+		{Name: "gitea", Image: "gitea/gitea:1.22.1", Volumes: []string{"/data"}},
+		{Name: "dev-control-plane", Image: "kindest/node:v1.30.0", Volumes: []string{"/var", "/lib/modules"}},
+	}, snap.Containers)
+
+	tmpDir := filepath.Join(dir, "base.tmp")
+	require.Equal(t, []string{
+		"docker container inspect -f " + inspectFormat + " gitea",
+		"docker container inspect -f " + inspectFormat + " dev-control-plane",
+		"docker container stop gitea dev-control-plane",
+		"docker run --rm --volumes-from gitea -v " + tmpDir + ":/snapshot --entrypoint sh gitea/gitea:1.22.1 -c tar -C /data -cf /snapshot/gitea_data.tar .",
+		"docker run --rm --volumes-from dev-control-plane -v " + tmpDir + ":/snapshot --entrypoint sh kindest/node:v1.30.0 -c tar -C /var -cf /snapshot/dev-control-plane_var.tar .",
+		"docker run --rm --volumes-from dev-control-plane -v " + tmpDir + ":/snapshot --entrypoint sh kindest/node:v1.30.0 -c tar -C /lib/modules -cf /snapshot/dev-control-plane_lib_modules.tar .",
+		"docker container start gitea dev-control-plane",
+	}, runner.Commands())
+
+	// The snapshot is moved in place only when it's complete
+	require.NoDirExists(t, tmpDir)
+	saved, err := c.Get("base")
+	require.NoError(t, err)
+	require.Equal(t, snap.Containers, saved.Containers)
+
+	runner = exec.NewFakeRunner()
+	c = NewClient(dir, container.Docker, runner, io.Discard)
+
+	_, err = c.Restore(context.Background(), "base")
+	require.NoError(t, err)
+
+	snapDir := filepath.Join(dir, "base")
+	require.Equal(t, []string{
+		"docker container stop gitea dev-control-plane",
+		"docker run --rm --volumes-from gitea -v " + snapDir + ":/snapshot --entrypoint sh gitea/gitea:1.22.1 -c find /data -mindepth 1 -delete && tar -C /data -xpf /snapshot/gitea_data.tar",
+		"docker run --rm --volumes-from dev-control-plane -v " + snapDir + ":/snapshot --entrypoint sh kindest/node:v1.30.0 -c find /var -mindepth 1 -delete && tar -C /var -xpf /snapshot/dev-control-plane_var.tar",
+		"docker run --rm --volumes-from dev-control-plane -v " + snapDir + ":/snapshot --entrypoint sh kindest/node:v1.30.0 -c find /lib/modules -mindepth 1 -delete && tar -C /lib/modules -xpf /snapshot/dev-control-plane_lib_modules.tar",
+		"docker container start gitea dev-control-plane",
+	}, runner.Commands())
+}
+
+func TestTakeFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	// A good snapshot isn't replaced by a failed one
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "base"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base", metadataFile), []byte(`{"name":"base"}`), 0644))
+
+	runner := exec.NewFakeRunner().
+		On("docker container inspect", exec.Result{Stdout: []byte("gitea/gitea:1.22.1 /data")}, nil).
+		OnExit("docker run", 1, "tar: write error")
+
+	c := NewClient(dir, container.Docker, runner, io.Discard)
+
+	_, err := c.Take(context.Background(), Opts{Name: "base", Containers: []string{"gitea"}})
+	require.ErrorContains(t, err, "failed to save volume /data of gitea")
+
+	// The containers are started again so the environment can still be used
+	commands := runner.Commands()
+	require.Equal(t, "docker container start gitea", commands[len(commands)-1])
+
+	require.NoDirExists(t, filepath.Join(dir, "base.tmp"))
+	_, err = c.Get("base")
+	require.NoError(t, err)
+}